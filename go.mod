@@ -16,6 +16,9 @@ require (
 	github.com/soellman/pidfile v0.0.0-20160225184504-d482c905736b
 	github.com/tidwall/gjson v1.8.1
 	golang.org/x/crypto v0.0.0-20210813211128-0a44fdfbc16e
+	golang.org/x/image v0.0.0-20220722155232-062f8c9fd539
+	golang.org/x/net v0.0.0-20210813160813-60bc85c4be6d
+	golang.org/x/sys v0.0.0-20220808155132-1c4a2a72c664
 )
 
 require (
@@ -37,9 +40,6 @@ require (
 	github.com/tidwall/pretty v1.2.0 // indirect
 	go.deanishe.net/env v0.5.1 // indirect
 	go.deanishe.net/fuzzy v1.0.0 // indirect
-	golang.org/x/image v0.0.0-20220722155232-062f8c9fd539 // indirect
-	golang.org/x/net v0.0.0-20210813160813-60bc85c4be6d // indirect
-	golang.org/x/sys v0.0.0-20220808155132-1c4a2a72c664 // indirect
 	golang.org/x/text v0.3.7 // indirect
 	gopkg.in/toast.v1 v1.0.0-20180812000517-0a84660828b2 // indirect
 )
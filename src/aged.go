@@ -0,0 +1,123 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jychri/tilde"
+)
+
+const day = 24 * time.Hour
+
+// agedBucket groups the logins of the aged passwords report, in the order they are shown
+type agedBucket struct {
+	Name  string
+	Title string
+}
+
+var agedBuckets = []agedBucket{
+	{Name: "never", Title: "Never rotated"},
+	{Name: "2y", Title: "Older than 2 years"},
+	{Name: "1y", Title: "Older than 1 year"},
+	{Name: "policy", Title: "Older than their maximum age"},
+}
+
+// passwordAgePolicy sets the maximum age in days of the passwords, per folder or collection.
+// A folder applies to its subfolders too, the strictest maximum age of an item wins.
+//
+//	{"default": 365, "folders": {"Work/Infra": 90}, "collections": {"Finance": 180}}
+type passwordAgePolicy struct {
+	Default     int            `json:"default"`
+	Folders     map[string]int `json:"folders"`
+	Collections map[string]int `json:"collections"`
+}
+
+// loadPasswordAgePolicy reads the policy file, without a file PASSWORD_MAX_AGE applies to all logins
+func loadPasswordAgePolicy(path string, defaultDays int) (passwordAgePolicy, error) {
+	policy := passwordAgePolicy{Default: defaultDays}
+	if path == "" {
+		return policy, nil
+	}
+	data, err := os.ReadFile(tilde.Abs(path))
+	if err != nil {
+		return policy, err
+	}
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return policy, fmt.Errorf("invalid password age policy %s: %w", path, err)
+	}
+	if policy.Default <= 0 {
+		policy.Default = defaultDays
+	}
+	return policy, nil
+}
+
+// maxAge returns the maximum age of the password of the item and where it comes from, e.g. "folder Work/Infra"
+func (p passwordAgePolicy) maxAge(item Item, ctx searchContext) (time.Duration, string) {
+	days, source := p.Default, ""
+	stricter := func(maxDays int, from string) {
+		if maxDays > 0 && maxDays < days {
+			days, source = maxDays, from
+		}
+	}
+	if folder, ok := ctx.Folders[item.FolderId]; ok && item.FolderId != "" {
+		for path, maxDays := range p.Folders {
+			if isInFolderPath(folder, path) {
+				stricter(maxDays, fmt.Sprintf("folder %s", path))
+			}
+		}
+	}
+	for _, id := range item.CollectionIds {
+		name := ctx.Collections[id]
+		for _, key := range []string{id, name} {
+			if maxDays, ok := p.Collections[key]; ok {
+				stricter(maxDays, fmt.Sprintf("collection %s", name))
+			}
+		}
+	}
+	return time.Duration(days) * day, source
+}
+
+// passwordAge is the time since the password was changed, or since the item was created if it never was
+func passwordAge(item Item, now time.Time) (age time.Duration, never bool) {
+	if !item.Login.PasswordRevisionDate.IsZero() {
+		return now.Sub(item.Login.PasswordRevisionDate), false
+	}
+	created := item.CreationDate
+	if created.IsZero() {
+		// caches of older versions don't have the creation date
+		created = item.RevisionDate
+	}
+	return now.Sub(created), true
+}
+
+// agedBucketName returns the bucket of the login if its password is older than the maximum age
+func agedBucketName(age time.Duration, never bool, maxAge time.Duration) (string, bool) {
+	switch {
+	case age <= maxAge:
+		return "", false
+	case never:
+		return "never", true
+	case age > 2*365*day:
+		return "2y", true
+	case age > 365*day:
+		return "1y", true
+	}
+	return "policy", true
+}
+
+// formatAge shows the age in days, months or years
+func formatAge(age time.Duration) string {
+	days := int(age / day)
+	switch {
+	case days < 60:
+		return fmt.Sprintf("%d days", days)
+	case days < 730:
+		return fmt.Sprintf("%d months", days/30)
+	}
+	return fmt.Sprintf("%d years", days/365)
+}
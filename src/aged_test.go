@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_passwordAgePolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	policy := `{"folders": {"Work": 180, "Work/Infra": 90}, "collections": {"Finance": 30}}`
+	if err := os.WriteFile(path, []byte(policy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := loadPasswordAgePolicy(path, 365)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := searchContext{
+		Folders:     map[string]string{"1": "Private", "2": "Work", "3": "Work/Infra/AWS"},
+		Collections: map[string]string{"c1": "Finance", "c2": "Marketing"},
+	}
+	tests := []struct {
+		name   string
+		item   Item
+		days   int
+		source string
+	}{
+		{"default", Item{FolderId: "1"}, 365, ""},
+		{"folder", Item{FolderId: "2"}, 180, "folder Work"},
+		{"subfolder takes the strictest", Item{FolderId: "3"}, 90, "folder Work/Infra"},
+		{"collection", Item{FolderId: "3", CollectionIds: []string{"c2", "c1"}}, 30, "collection Finance"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxAge, source := p.maxAge(tt.item, ctx)
+			if maxAge != time.Duration(tt.days)*day || source != tt.source {
+				t.Errorf("maxAge() = %s %q, want %d days %q", maxAge, source, tt.days, tt.source)
+			}
+		})
+	}
+}
+
+func Test_agedBucketName(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	maxAge := 90 * day
+	tests := []struct {
+		name string
+		item Item
+		want string
+	}{
+		{"recent", Item{Login: Login{PasswordRevisionDate: now.Add(-10 * day)}}, ""},
+		{"above policy", Item{Login: Login{PasswordRevisionDate: now.Add(-100 * day)}}, "policy"},
+		{"one year", Item{Login: Login{PasswordRevisionDate: now.Add(-400 * day)}}, "1y"},
+		{"two years", Item{Login: Login{PasswordRevisionDate: now.Add(-800 * day)}}, "2y"},
+		{"never rotated", Item{CreationDate: now.Add(-800 * day)}, "never"},
+		{"never rotated but new", Item{CreationDate: now.Add(-5 * day)}, ""},
+		{"cache without creation date", Item{RevisionDate: now.Add(-100 * day)}, "never"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			age, never := passwordAge(tt.item, now)
+			got, _ := agedBucketName(age, never, maxAge)
+			if got != tt.want {
+				t.Errorf("agedBucketName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
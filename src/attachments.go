@@ -0,0 +1,253 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blacs30/bitwarden-alfred-workflow/alfred"
+	aw "github.com/deanishe/awgo"
+	"github.com/deanishe/awgo/util"
+	"github.com/jychri/tilde"
+)
+
+// attachmentsDir is the private directory in which attachments are opened,
+// every attachment gets its own sub directory which is wiped after ATTACHMENT_OPEN_TIMEOUT
+func attachmentsDir() string {
+	return filepath.Join(wf.CacheDir(), "attachments")
+}
+
+// runAddAttachment uploads the file path in the query as new attachment of the item
+func runAddAttachment() {
+	wf.Configure(aw.TextErrors(true))
+	if opts.Id == "" {
+		wf.Fatal("No id sent.")
+		return
+	}
+	path := tilde.Abs(queryArgs())
+	if _, err := os.Stat(path); err != nil {
+		wf.FatalError(err)
+		return
+	}
+	token, err := alfred.GetToken(wf)
+	if err != nil {
+		wf.Fatal("Get Token error")
+		return
+	}
+
+	log.Printf("Uploading attachment %s for id %s", path, opts.Id)
+	message := "Failed to upload Bitwarden attachment."
+	args := []string{conf.BwExec, "create", "attachment", "--file", path, "--itemid", opts.Id, "--session", token}
+	result, err := runCmdArgs(args, message)
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+
+	// the Bitwarden CLI returns the updated item
+	var item Item
+	err = json.Unmarshal([]byte(strings.Join(result, " ")), &item)
+	if err != nil {
+		log.Printf("Failed to unmarshall body. Err: %s", err)
+	} else {
+		err = updateCachedItem(opts.Id, func(cached *Item) {
+			cached.Attachments = item.Attachments
+		})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	fmt.Printf("Uploaded attachment %s", filepath.Base(path))
+}
+
+// runConfirmDeleteAttachment asks before the attachment is deleted, it can't be restored
+func runConfirmDeleteAttachment() {
+	wf.Configure(aw.SuppressUIDs(true))
+	if opts.Id == "" || opts.Attachment == "" {
+		wf.Fatal("No id or attachment id sent.")
+		return
+	}
+
+	fileName := opts.Attachment
+	items, err := loadCachedItems()
+	if err != nil {
+		log.Println(err)
+	}
+	for _, item := range items {
+		if item.Id != opts.Id {
+			continue
+		}
+		for _, att := range item.Attachments {
+			if att.Id == opts.Attachment {
+				fileName = att.FileName
+			}
+		}
+	}
+
+	wf.NewItem(fmt.Sprintf("Delete Attachment %s?", fileName)).
+		Subtitle("↩ or ⇥ delete it from Bitwarden, this can't be undone").
+		Icon(aw.IconTrash).
+		Valid(true).
+		Var("notification", fmt.Sprintf("Delete attachment:\n%s", fileName)).
+		Var("action", "-deleteattachment").
+		Var("action2", fmt.Sprintf("-attachment %s", opts.Attachment)).
+		Var("action3", fmt.Sprintf("-id %s", opts.Id))
+	wf.SendFeedback()
+}
+
+// runDeleteAttachment deletes the attachment from the item
+func runDeleteAttachment() {
+	wf.Configure(aw.TextErrors(true))
+	if opts.Id == "" || opts.Attachment == "" {
+		wf.Fatal("No id or attachment id sent.")
+		return
+	}
+	token, err := alfred.GetToken(wf)
+	if err != nil {
+		wf.Fatal("Get Token error")
+		return
+	}
+
+	log.Printf("Deleting attachment %s for id %s", opts.Attachment, opts.Id)
+	message := "Failed to delete Bitwarden attachment."
+	args := fmt.Sprintf("%s delete attachment %s --itemid %s --session %s", conf.BwExec, opts.Attachment, opts.Id, token)
+	_, err = runCmd(args, message)
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+
+	err = updateCachedItem(opts.Id, func(cached *Item) {
+		var attachments []Attachments
+		for _, att := range cached.Attachments {
+			if att.Id != opts.Attachment {
+				attachments = append(attachments, att)
+			}
+		}
+		cached.Attachments = attachments
+	})
+	if err != nil {
+		log.Println(err)
+	}
+	fmt.Println("Deleted attachment")
+}
+
+// runOpenAttachment downloads the attachment into a private directory and opens it in the default app
+func runOpenAttachment() {
+	wf.Configure(aw.TextErrors(true))
+	if opts.Id == "" || opts.Attachment == "" {
+		wf.Fatal("No id or attachment id sent.")
+		return
+	}
+	token, err := alfred.GetToken(wf)
+	if err != nil {
+		wf.Fatal("Get Token error")
+		return
+	}
+
+	err = os.MkdirAll(attachmentsDir(), 0700)
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+	dir, err := os.MkdirTemp(attachmentsDir(), "open-")
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+
+	log.Printf("Opening attachment %s for id %s", opts.Attachment, opts.Id)
+	message := "Failed to get Bitwarden attachment."
+	args := []string{conf.BwExec, "get", "attachment", opts.Attachment, "--itemid", opts.Id, "--output", fmt.Sprintf("%s/", dir), "--session", token}
+	_, err = runCmdArgs(args, message)
+	if err != nil {
+		os.RemoveAll(dir)
+		wf.FatalError(err)
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) == 0 {
+		os.RemoveAll(dir)
+		wf.Fatal("Attachment wasn't saved.")
+		return
+	}
+	path := filepath.Join(dir, entries[0].Name())
+
+	startWipeAttachments()
+
+	cmd := exec.Command("/usr/bin/open", path)
+	if _, err := util.RunCmd(cmd); err != nil {
+		wf.Fatalf("/usr/bin/open %q: %v", path, err)
+	}
+	recordUsage(opts.Id)
+	fmt.Printf("Opened %s, it will be removed in %d minutes", entries[0].Name(), conf.AttachmentOpenTimeout)
+}
+
+func startWipeAttachments() {
+	if !wf.IsRunning("wipe-attachments") {
+		cmd := exec.Command(os.Args[0], "-wipeattachments")
+		log.Println("Wipe attachments cmd: ", cmd)
+		if err := wf.RunInBackground("wipe-attachments", cmd); err != nil {
+			log.Println(err)
+		}
+	} else {
+		log.Printf("Wipe attachments job already running.")
+	}
+}
+
+// runWipeAttachments runs in the background until all opened attachments are wiped
+func runWipeAttachments() {
+	for {
+		next, err := wipeExpiredAttachments(attachmentsDir(), conf.AttachmentMaxOpenAge)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		if next == 0 {
+			log.Println("Finished wiping attachments.")
+			return
+		}
+		log.Printf("Next attachment expires in %s", next)
+		time.Sleep(next)
+	}
+}
+
+// wipeExpiredAttachments removes the opened attachments in dir older than maxAge
+// and returns the time until the next one expires, 0 if none is left
+func wipeExpiredAttachments(dir string, maxAge time.Duration) (time.Duration, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	var next time.Duration
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		age := time.Since(info.ModTime())
+		if age >= maxAge {
+			debugLog(fmt.Sprintf("Wiping opened attachment %s", entry.Name()))
+			if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+				log.Println(err)
+			}
+			continue
+		}
+		if remaining := maxAge - age; next == 0 || remaining < next {
+			next = remaining
+		}
+	}
+	return next, nil
+}
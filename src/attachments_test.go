@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func Test_wipeExpiredAttachments(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		ages     map[string]time.Duration
+		maxAge   time.Duration
+		wantLeft []string
+		wantNext time.Duration
+	}{
+		{name: "nothing opened", maxAge: time.Minute},
+		{name: "all expired", ages: map[string]time.Duration{"open-1": 2 * time.Minute, "open-2": time.Minute}, maxAge: time.Minute},
+		{name: "wipe on lock", ages: map[string]time.Duration{"open-1": 0}, maxAge: 0},
+		{
+			name:     "next expiry",
+			ages:     map[string]time.Duration{"open-1": 2 * time.Minute, "open-2": 30 * time.Second, "open-3": 45 * time.Second},
+			maxAge:   time.Minute,
+			wantLeft: []string{"open-2", "open-3"},
+			wantNext: 15 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, age := range tt.ages {
+				path := filepath.Join(dir, name)
+				if err := os.Mkdir(path, 0700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(path, "secret.txt"), []byte("secret"), 0600); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			next, err := wipeExpiredAttachments(dir, tt.maxAge)
+			if err != nil {
+				t.Fatalf("wipeExpiredAttachments() error = %v", err)
+			}
+			// the remaining time shrinks while the test runs
+			if next > tt.wantNext || next < tt.wantNext-5*time.Second {
+				t.Errorf("wipeExpiredAttachments() next = %v, want %v", next, tt.wantNext)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var left []string
+			for _, entry := range entries {
+				left = append(left, entry.Name())
+			}
+			sort.Strings(left)
+			if !reflect.DeepEqual(left, tt.wantLeft) {
+				t.Errorf("wipeExpiredAttachments() left = %v, want %v", left, tt.wantLeft)
+			}
+		})
+	}
+
+	t.Run("missing directory", func(t *testing.T) {
+		next, err := wipeExpiredAttachments(filepath.Join(t.TempDir(), "attachments"), time.Minute)
+		if err != nil || next != 0 {
+			t.Errorf("wipeExpiredAttachments() = %v, %v, want 0, nil", next, err)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// the delay of the automatic sync after the first failure, it doubles with every failure up to syncBackoffMax
+const (
+	syncBackoffBase = time.Minute
+	syncBackoffMax  = 2 * time.Hour
+)
+
+// syncBackoff delays the automatic sync after failed syncs, e.g. while offline
+type syncBackoff struct {
+	Failures int       `json:"failures"`
+	Next     time.Time `json:"next"`
+}
+
+// failed returns the backoff after another failed sync
+func (b syncBackoff) failed(now time.Time) syncBackoff {
+	b.Failures++
+	delay := syncBackoffMax
+	if b.Failures <= 16 {
+		if d := syncBackoffBase << (b.Failures - 1); d < syncBackoffMax {
+			delay = d
+		}
+	}
+	b.Next = now.Add(delay)
+	return b
+}
+
+// allows reports whether the automatic sync may run
+func (b syncBackoff) allows(now time.Time) bool {
+	return !now.Before(b.Next)
+}
+
+func loadSyncBackoff() syncBackoff {
+	var backoff syncBackoff
+	if wf.Cache.Exists(SYNC_BACKOFF_NAME) {
+		if err := wf.Cache.LoadJSON(SYNC_BACKOFF_NAME, &backoff); err != nil {
+			log.Printf("Couldn't load the sync backoff, error: %s", err)
+		}
+	}
+	return backoff
+}
+
+// recordSyncResult resets the backoff after a successful sync, or increases it after a failed one
+func recordSyncResult(syncErr error) {
+	if syncErr == nil {
+		if err := wf.Cache.StoreJSON(SYNC_BACKOFF_NAME, nil); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+	backoff := loadSyncBackoff().failed(time.Now())
+	log.Printf("Sync failed %d times, next automatic sync at %s", backoff.Failures, backoff.Next.Format(time.RFC3339))
+	if err := wf.Cache.StoreJSON(SYNC_BACKOFF_NAME, backoff); err != nil {
+		log.Println(err)
+	}
+}
+
+// startBackgroundSync runs a forced sync in the background unless a sync is already running,
+// a quiet sync doesn't open the search when it's done, e.g. while the user types
+func startBackgroundSync(quiet bool) error {
+	if wf.IsRunning("sync") {
+		log.Printf("Sync job already running.")
+		return nil
+	}
+	log.Printf("Starting sync job.")
+	cmd := exec.Command(os.Args[0], "-sync", "-force")
+	if quiet {
+		cmd.Env = append(os.Environ(), "BACKGROUND_SYNC_DAEMON=true")
+	}
+	log.Println("Sync cmd: ", cmd)
+	return wf.RunInBackground("sync", cmd)
+}
+
+// autoSync starts a sync in the background if the last one is older than SYNC_MAX_AGE,
+// the search keeps showing the cached items meanwhile. It returns whether a sync is running.
+func autoSync() bool {
+	if conf.SyncMaxCacheAge <= 0 || !wf.Cache.Exists(SYNC_CACHE_NAME) {
+		return false
+	}
+	if wf.IsRunning("sync") {
+		return true
+	}
+	if !wf.Cache.Expired(SYNC_CACHE_NAME, conf.SyncMaxCacheAge) {
+		return false
+	}
+	// a locked vault can't be synced, that's no failure
+	if bwData.UserId == "" || bwData.ProtectedKey == "" {
+		return false
+	}
+	if backoff := loadSyncBackoff(); !backoff.allows(time.Now()) {
+		debugLog(fmt.Sprintf("Automatic sync delayed until %s after %d failures", backoff.Next.Format(time.RFC3339), backoff.Failures))
+		return false
+	}
+	if err := startBackgroundSync(true); err != nil {
+		log.Println(err)
+		return false
+	}
+	return true
+}
+
+// addRefreshingItem is the last row of the search while the cache is synced in the background
+func addRefreshingItem() {
+	wf.NewItem("Refreshing in the background…").
+		Subtitle("Showing the cached items, the next search shows the synced ones.").
+		Valid(false).
+		UID("refreshing").
+		Icon(iconReload)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_syncBackoff(t *testing.T) {
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		failures  int
+		wantDelay time.Duration
+	}{
+		{name: "first failure", failures: 1, wantDelay: time.Minute},
+		{name: "second failure", failures: 2, wantDelay: 2 * time.Minute},
+		{name: "fifth failure", failures: 5, wantDelay: 16 * time.Minute},
+		{name: "capped", failures: 8, wantDelay: syncBackoffMax},
+		{name: "many failures", failures: 100, wantDelay: syncBackoffMax},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var backoff syncBackoff
+			for i := 0; i < tt.failures; i++ {
+				backoff = backoff.failed(now)
+			}
+			if backoff.Failures != tt.failures {
+				t.Errorf("failed() failures = %d, want %d", backoff.Failures, tt.failures)
+			}
+			if got := backoff.Next.Sub(now); got != tt.wantDelay {
+				t.Errorf("failed() delay = %s, want %s", got, tt.wantDelay)
+			}
+			if backoff.allows(now.Add(tt.wantDelay - time.Second)) {
+				t.Error("allows() before the delay passed")
+			}
+			if !backoff.allows(now.Add(tt.wantDelay)) {
+				t.Error("allows() = false after the delay passed")
+			}
+		})
+	}
+
+	if !(syncBackoff{}).allows(now) {
+		t.Error("allows() = false without failures")
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"strings"
 	"time"
 
@@ -22,40 +21,42 @@ import (
 const (
 	NOT_LOGGED_IN_MSG = "Not logged in. Need to login first."
 	NOT_UNLOCKED_MSG  = "Not unlocked. Need to unlock first."
+	LOCKED_CACHE_MSG  = "Locked, unlock to search."
 )
 
 // Scan for projects and cache results
 func runSync(force bool, last bool) {
 
 	wf.Configure(aw.TextErrors(true))
+	// syncs of the daemon and automatic syncs of the search never open Alfred
+	quiet := os.Getenv("BACKGROUND_SYNC_DAEMON") == "true"
 	email := conf.Email
 	if email == "" {
-		searchAlfred(fmt.Sprintf("%s email", conf.BwconfKeyword))
+		if !quiet {
+			searchAlfred(fmt.Sprintf("%s email", conf.BwconfKeyword))
+		}
 		wf.Fatal("No email configured.")
 	}
 	loginErr, unlockErr := BitwardenAuthChecks()
 	if loginErr != nil {
 		fmt.Println(NOT_LOGGED_IN_MSG)
-		searchAlfred(fmt.Sprintf("%s login", conf.BwauthKeyword))
+		if !quiet {
+			searchAlfred(fmt.Sprintf("%s login", conf.BwauthKeyword))
+		}
 		return
 	}
 	if unlockErr != nil {
 		fmt.Println(NOT_UNLOCKED_MSG)
-		searchAlfred(fmt.Sprintf("%s unlock", conf.BwauthKeyword))
+		if !quiet {
+			searchAlfred(fmt.Sprintf("%s unlock", conf.BwauthKeyword))
+		}
 		return
 	}
 
 	if opts.Background {
 		log.Println("Running sync in background")
-		if !wf.IsRunning("sync") {
-			log.Printf("Starting sync job.")
-			cmd := exec.Command(os.Args[0], "-sync", "-force")
-			log.Println("Sync cmd: ", cmd)
-			if err := wf.RunInBackground("sync", cmd); err != nil {
-				wf.FatalError(err)
-			}
-		} else {
-			log.Printf("Sync job already running.")
+		if err := startBackgroundSync(false); err != nil {
+			wf.FatalError(err)
 		}
 		searchAlfred(conf.BwKeyword)
 		return
@@ -93,6 +94,8 @@ func runSync(force bool, last bool) {
 
 		_, err = runCmd(args, message)
 		if err != nil {
+			// failures delay the automatic sync of the search
+			recordSyncResult(err)
 			wf.FatalError(err)
 		}
 		// Printing the "Last sync date" or the message "synced"
@@ -104,13 +107,11 @@ func runSync(force bool, last bool) {
 			log.Println(err)
 		}
 
-		// Creating the items cache
+		// Creating the items cache, failures of the list commands are recorded there
 		runCache()
+		recordSyncResult(nil)
 
-		// If we ran the sync via the daemon
-		// don't open the search
-		backgroundSyncDaemon := os.Getenv("BACKGROUND_SYNC_DAEMON")
-		if backgroundSyncDaemon == "true" {
+		if quiet {
 			return
 		}
 		searchAlfred(conf.BwKeyword)
@@ -127,8 +128,25 @@ func runLock() {
 	}
 
 	message := "Locking Bitwarden failed."
-	log.Println("Clearing items cache.")
-	err = clearCache()
+	if conf.CacheKeyFromSession {
+		// the items cache can't be read until the next unlock, so it's kept for the incremental sync
+		err = clearMetadataCache()
+	} else {
+		err = clearCache()
+	}
+	if err != nil {
+		log.Println(err)
+	}
+	// the next sync creates the index again
+	if err := clearIconIndex(); err != nil {
+		log.Println(err)
+	}
+	if err := removeHibpRangeCache(); err != nil {
+		log.Println(err)
+	}
+
+	log.Println("Wiping opened attachments.")
+	_, err = wipeExpiredAttachments(attachmentsDir(), 0)
 	if err != nil {
 		log.Println(err)
 	}
@@ -148,12 +166,39 @@ func getItems() {
 		wf.Fatal("Get Token error")
 	}
 
+	rules, err := newExclusionRules()
+	if err != nil {
+		wf.FatalError(err)
+	}
+
 	items := runGetItems(token)
 	folders := runGetFolders(token)
 
-	// prepare cached struct which excludes all secret data
-	populateCacheItems(items)
+	// collections and organizations are only used to show names, so errors aren't fatal
+	collections, err := runGetCollections(token)
+	if err != nil {
+		log.Println(err)
+	} else {
+		populateCacheCollections(collections)
+	}
+	organizations, err := runGetOrganizations(token)
+	if err != nil {
+		log.Println(err)
+	} else {
+		populateCacheOrganizations(organizations)
+	}
+
+	// prepare cached struct which excludes all secret data, the names are needed by the exclusion rules
+	populateCacheItems(items, rules, newSearchContext(folders, collections, organizations))
 	populateCacheFolders(folders)
+
+	// Sends are optional, e.g. they can be disabled by an organization policy
+	sends, err := runGetSends(token)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	populateCacheSends(sends)
 }
 
 // runGetItems uses the Bitwarden CLI to get all items and returns them to the calling function
@@ -165,6 +210,7 @@ func runGetItems(token string) []Item {
 	result, err := runCmd(args, message)
 	if err != nil {
 		log.Printf("Error is:\n%s", err)
+		recordSyncResult(err)
 		wf.FatalError(err)
 	}
 	// block here and return if no items (secrets) are found
@@ -257,13 +303,7 @@ func runGetItem() {
 				jsonPath = "login.totp"
 			}
 
-			var value gjson.Result
-			if bwData.ActiveUserId != "" {
-				// different location for version 1.21.1 and above
-				value = gjson.Get(string(data), fmt.Sprintf("%s.data.ciphers.encrypted.%s.%s", bwData.UserId, id, jsonPath))
-			} else {
-				value = gjson.Get(string(data), fmt.Sprintf("ciphers_%s.%s.%s", bwData.UserId, id, jsonPath))
-			}
+			value := lookupEncryptedValue(data, id, jsonPath)
 			if value.Exists() {
 				encryptedSecret = value.String()
 				debugLog(fmt.Sprintf("encryptedSecret value is: %v [truncated]", encryptedSecret[:5]))
@@ -336,9 +376,19 @@ func runGetItem() {
 			receivedItem = strings.Join(result, " ")
 		}
 	}
+	recordUsage(id)
 	fmt.Print(receivedItem)
 }
 
+// lookupEncryptedValue returns the encrypted value at the jsonPath of the item in the data.json
+func lookupEncryptedValue(data []byte, id string, jsonPath string) gjson.Result {
+	if bwData.ActiveUserId != "" {
+		// different location for version 1.21.1 and above
+		return gjson.GetBytes(data, fmt.Sprintf("%s.data.ciphers.encrypted.%s.%s", bwData.UserId, id, jsonPath))
+	}
+	return gjson.GetBytes(data, fmt.Sprintf("ciphers_%s.%s.%s", bwData.UserId, id, jsonPath))
+}
+
 func runGetFolders(token string) []Folder {
 	message := "Failed to get Bitwarden Folders."
 	args := fmt.Sprintf("%s list folders --pretty --session %s", conf.BwExec, token)
@@ -347,6 +397,7 @@ func runGetFolders(token string) []Folder {
 	result, err := runCmd(args, message)
 	if err != nil {
 		log.Printf("Error is:\n%s", err)
+		recordSyncResult(err)
 		wf.FatalError(err)
 	}
 	// block here and return if no items (secrets) are found
@@ -371,6 +422,48 @@ func runGetFolders(token string) []Folder {
 	return folders
 }
 
+// runGetCollections uses the Bitwarden CLI to get the collections of all organizations
+func runGetCollections(token string) ([]Collection, error) {
+	message := "Failed to get Bitwarden collections."
+	args := fmt.Sprintf("%s list collections --session %s", conf.BwExec, token)
+	log.Println("Read latest collections...")
+
+	result, err := runCmd(args, message)
+	if err != nil {
+		return nil, err
+	}
+	var collections []Collection
+	if len(result) > 0 {
+		err = json.Unmarshal([]byte(strings.Join(result, " ")), &collections)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshall collections: %w", err)
+		}
+	}
+	debugLog(fmt.Sprintf("Found %d collections.", len(collections)))
+	return collections, nil
+}
+
+// runGetOrganizations uses the Bitwarden CLI to get the organizations of the user
+func runGetOrganizations(token string) ([]Organization, error) {
+	message := "Failed to get Bitwarden organizations."
+	args := fmt.Sprintf("%s list organizations --session %s", conf.BwExec, token)
+	log.Println("Read latest organizations...")
+
+	result, err := runCmd(args, message)
+	if err != nil {
+		return nil, err
+	}
+	var organizations []Organization
+	if len(result) > 0 {
+		err = json.Unmarshal([]byte(strings.Join(result, " ")), &organizations)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshall organizations: %w", err)
+		}
+	}
+	debugLog(fmt.Sprintf("Found %d organizations.", len(organizations)))
+	return organizations, nil
+}
+
 // Unlock Bitwarden
 func runUnlock() {
 	wf.Configure(aw.TextErrors(true))
@@ -577,6 +670,9 @@ func runLogout() {
 	if err != nil {
 		log.Println(err)
 	}
+	if err := clearIconIndex(); err != nil {
+		log.Println(err)
+	}
 	message := "Logout of Bitwarden failed."
 	_, err = runCmd(args, message)
 	if err != nil {
@@ -586,7 +682,7 @@ func runLogout() {
 }
 
 func runCache() {
-	err := clearCache()
+	err := clearMetadataCache()
 	if err != nil {
 		log.Print("Error while deleting Caches ", err)
 	}
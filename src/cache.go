@@ -2,18 +2,14 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"os/exec"
-	"strings"
 	"time"
 
 	aw "github.com/deanishe/awgo"
-	"github.com/jpillora/go-tld"
-	"github.com/jychri/tilde"
 )
 
 var itemTypes = map[string]int{
@@ -29,157 +25,330 @@ func getItemTypeByName(name string) int {
 
 }
 
-func isItemIdFound(itemId []string, item Item) bool {
-	for _, id := range itemId {
-		if item.Type == getItemTypeByName(id) {
-			return true
-		}
-	}
-	return false
-}
-
-func populateCacheItems(items []Item) {
+func populateCacheItems(items []Item, rules exclusionRules, ctx searchContext) {
 	start := time.Now()
 
-	var cacheItems []Item
-
-	skipItems := strings.Split(conf.SkipTypes, ",")
+	var keptItems []Item
+	excluded := map[string]int{}
 
 	debugLog(fmt.Sprintf("Total Items # %d", len(items)))
 
 	for k, item := range items {
 		debugLog(fmt.Sprintf("Item # %d item.Name %s\n", k, item.Name))
-		if isItemIdFound(skipItems, item) {
-			return
-		}
-		var tempItem Item
-		tempItem.Object = item.Object
-		tempItem.Id = item.Id
-		tempItem.OrganizationId = item.OrganizationId
-		tempItem.FolderId = item.FolderId
-		tempItem.Type = item.Type
-		tempItem.Name = item.Name
-		tempItem.Favorite = item.Favorite
-		tempItem.CollectionIds = item.CollectionIds
-		tempItem.RevisionDate = item.RevisionDate
-
-		// special cases because we don't want to cache secrets
-		if item.Type == 2 {
-			noteValue := ""
-			if item.Notes != "" {
-				noteValue = "hidden"
-			}
-			tempItem.Notes = noteValue
-		} else {
-			tempItem.Notes = item.Notes
-		}
-		shortNumber := item.Card.Number
-		if item.Card.Number != "" {
-			shortNumber = fmt.Sprintf("*%s", shortNumber[len(shortNumber)-4:])
+		if rule, ok := rules.excludes(item, ctx); ok {
+			debugLog(fmt.Sprintf("Excluded by %s rule: %s", rule, item.Name))
+			excluded[rule]++
+			continue
 		}
-		codeValue := "hidden"
-		if item.Card.Code == "" {
-			codeValue = ""
+		keptItems = append(keptItems, item)
+	}
+	if err := wf.Cache.StoreJSON(EXCLUDED_CACHE_NAME, excluded); err != nil {
+		log.Println(err)
+	}
+
+	// only the items added or changed since the last sync are converted again
+	previous, err := loadPreviousCacheItems()
+	if err != nil {
+		log.Printf("Rebuilding the whole items cache, the previous one couldn't be loaded: %s", err)
+	}
+	cacheItems, diff, newDomains := mergeCacheItems(previous, keptItems)
+	log.Printf("Items cache: %d added, %d changed, %d deleted, %d unchanged", diff.Added, diff.Changed, diff.Deleted, diff.Unchanged)
+
+	debugLog(fmt.Sprintf("Total cacheItems # %d", len(cacheItems)))
+
+	data, err := json.Marshal(cacheItems)
+	if err != nil {
+		log.Println(err)
+	}
+
+	if err := Encrypt(data, len(cacheItems)); err != nil {
+		log.Printf("Couldn't write the items cache, error: %s", err)
+	}
+
+	updateIconIndex(cacheItems, newDomains)
+
+	// calculate to duration
+	elapsed := time.Since(start)
+	debugLog(fmt.Sprintf("Function exec time took %s", elapsed))
+}
+
+// queueIcons adds the URLs by domain to the icons fetched by the next icons job
+func queueIcons(urls map[string]string) error {
+	queue := map[string]string{}
+	if wf.Data.Exists(ICON_QUEUE_NAME) {
+		if err := wf.Data.LoadJSON(ICON_QUEUE_NAME, &queue); err != nil {
+			log.Printf("Couldn't load the icon queue, error: %s", err)
 		}
-		tempItem.Card = CardInfo{
-			CardHolderName: item.Card.CardHolderName,
-			Brand:          item.Card.Brand,
-			Number:         shortNumber,
-			ExpMonth:       item.Card.ExpMonth,
-			ExpYear:        item.Card.ExpYear,
-			Code:           codeValue,
+	}
+	for id, url := range urls {
+		queue[id] = url
+	}
+	return wf.Data.StoreJSON(ICON_QUEUE_NAME, queue)
+}
+
+// cacheDiff counts the changes of the items since the last sync
+type cacheDiff struct {
+	Added     int
+	Changed   int
+	Deleted   int
+	Unchanged int
+}
+
+// isCacheInvalid reports whether the items cache can't be read and has to be rebuilt
+func isCacheInvalid(err error) bool {
+	return errors.Is(err, errCacheCorrupt) || errors.Is(err, errCacheOutdated)
+}
+
+// rebuildCache removes the invalid items cache and creates it again with a sync in the background,
+// it returns false if the sync can't start because Bitwarden is locked
+func rebuildCache(reason error) bool {
+	log.Printf("Rebuilding the items cache, %s", reason)
+	// the running sync writes a new cache, it mustn't be removed
+	if wf.IsRunning("sync") {
+		return true
+	}
+	if err := wf.Cache.StoreJSON(CACHE_NAME, nil); err != nil {
+		log.Println(err)
+	}
+	if bwData.UserId == "" || bwData.ProtectedKey == "" {
+		return false
+	}
+	if err := startBackgroundSync(true); err != nil {
+		log.Println(err)
+		return false
+	}
+	return true
+}
+
+// addRebuildingCacheItem shows that the items cache is rebuilt, or how to rebuild it
+func addRebuildingCacheItem(reason error, started bool) {
+	if !started {
+		wf.NewItem("The items cache has to be rebuilt").
+			Subtitle(fmt.Sprintf("%s, unlock Bitwarden to sync again", reason)).
+			Valid(false).
+			Icon(iconReload)
+		return
+	}
+	wf.Rerun(0.3)
+	wf.NewItem("Rebuilding the items cache…").
+		Subtitle(reason.Error()).
+		Valid(false).
+		Icon(ReloadIcon())
+}
+
+// loadCachedItems reads the items cache, it contains no secrets
+func loadCachedItems() ([]Item, error) {
+	var items []Item
+	if !wf.Cache.Exists(CACHE_NAME) {
+		return items, fmt.Errorf("no items cache found, run a sync first")
+	}
+	data, err := Decrypt()
+	if err != nil {
+		return items, err
+	}
+	err = json.Unmarshal(data, &items)
+	return items, err
+}
+
+// loadPreviousCacheItems returns the cached items by id
+func loadPreviousCacheItems() (map[string]Item, error) {
+	previous := map[string]Item{}
+	if !wf.Cache.Exists(CACHE_NAME) {
+		return previous, nil
+	}
+	items, err := loadCachedItems()
+	if err != nil {
+		return previous, err
+	}
+	for _, item := range items {
+		previous[item.Id] = item
+	}
+	return previous, nil
+}
+
+// mergeCacheItems keeps the cached version of the items with the same revision date and converts the others.
+// newDomains are the URLs by domain which the new and changed items didn't have before, their icons may need to be fetched.
+func mergeCacheItems(previous map[string]Item, items []Item) (cacheItems []Item, diff cacheDiff, newDomains map[string]string) {
+	newDomains = map[string]string{}
+	seen := map[string]bool{}
+	for _, item := range items {
+		seen[item.Id] = true
+		old, ok := previous[item.Id]
+		if ok && old.RevisionDate.Equal(item.RevisionDate) && !item.RevisionDate.IsZero() {
+			diff.Unchanged++
+			cacheItems = append(cacheItems, old)
+			continue
 		}
-		tempItem.SecureNote = item.SecureNote
-		passwordValue := "hidden"
-		if item.Login.Password == "" {
-			passwordValue = ""
+		if ok {
+			diff.Changed++
+		} else {
+			diff.Added++
 		}
-		totpValue := "hidden"
-		if item.Login.Totp == "" {
-			totpValue = ""
+		_, oldUrls := itemIconDomains(old)
+		domains, urls := itemIconDomains(item)
+		for _, domain := range domains {
+			if _, known := oldUrls[domain]; !known {
+				newDomains[domain] = urls[domain]
+			}
 		}
-		tempItem.Login = Login{
-			Uris:                 item.Login.Uris,
-			Username:             item.Login.Username,
-			Password:             passwordValue,
-			Totp:                 totpValue,
-			PasswordRevisionDate: item.Login.PasswordRevisionDate,
+		cacheItems = append(cacheItems, cacheItem(item))
+	}
+	for id := range previous {
+		if !seen[id] {
+			diff.Deleted++
 		}
-		tempItem.Identity = Identity{
-			Title:          item.Identity.Title,
-			FirstName:      item.Identity.FirstName,
-			MiddleName:     item.Identity.MiddleName,
-			LastName:       item.Identity.LastName,
-			Address1:       item.Identity.Address1,
-			Address2:       item.Identity.Address2,
-			Address3:       item.Identity.Address3,
-			City:           item.Identity.City,
-			State:          item.Identity.State,
-			PostalCode:     item.Identity.PostalCode,
-			Country:        item.Identity.Country,
-			Company:        item.Identity.Company,
-			Email:          item.Identity.Email,
-			Phone:          item.Identity.Email,
-			Ssn:            item.Identity.Ssn,
-			Username:       item.Identity.Username,
-			PassportNumber: item.Identity.PassportNumber,
-			LicenseNumber:  item.Identity.LicenseNumber,
+	}
+	return cacheItems, diff, newDomains
+}
+
+// cacheItem returns the item without its secrets, only whether they are set is cached
+func cacheItem(item Item) Item {
+	var tempItem Item
+	tempItem.Object = item.Object
+	tempItem.Id = item.Id
+	tempItem.OrganizationId = item.OrganizationId
+	tempItem.FolderId = item.FolderId
+	tempItem.Type = item.Type
+	tempItem.Name = item.Name
+	tempItem.Favorite = item.Favorite
+	tempItem.CollectionIds = item.CollectionIds
+	tempItem.RevisionDate = item.RevisionDate
+	tempItem.CreationDate = item.CreationDate
+
+	// special cases because we don't want to cache secrets
+	if item.Type == 2 {
+		noteValue := ""
+		if item.Notes != "" {
+			noteValue = "hidden"
 		}
-		var tempFields []Field
-		for _, field := range item.Fields {
-			if field.Type == 1 {
-				valueContent := "hidden"
-				if field.Value == "" {
-					valueContent = ""
-				}
-				tempFields = append(tempFields, Field{
-					Name:  field.Name,
-					Value: valueContent,
-					Type:  field.Type,
-				})
-			} else {
-				tempFields = append(tempFields, Field{
-					Name:  field.Name,
-					Value: field.Value,
-					Type:  field.Type,
-				})
+		tempItem.Notes = noteValue
+	} else {
+		tempItem.Notes = item.Notes
+	}
+	shortNumber := item.Card.Number
+	if item.Card.Number != "" {
+		shortNumber = fmt.Sprintf("*%s", shortNumber[len(shortNumber)-4:])
+	}
+	codeValue := "hidden"
+	if item.Card.Code == "" {
+		codeValue = ""
+	}
+	tempItem.Card = CardInfo{
+		CardHolderName: item.Card.CardHolderName,
+		Brand:          item.Card.Brand,
+		Number:         shortNumber,
+		ExpMonth:       item.Card.ExpMonth,
+		ExpYear:        item.Card.ExpYear,
+		Code:           codeValue,
+	}
+	tempItem.SecureNote = item.SecureNote
+	passwordValue := "hidden"
+	if item.Login.Password == "" {
+		passwordValue = ""
+	}
+	totpValue := "hidden"
+	if item.Login.Totp == "" {
+		totpValue = ""
+	}
+	tempItem.Login = Login{
+		Uris:                 item.Login.Uris,
+		Username:             item.Login.Username,
+		Password:             passwordValue,
+		Totp:                 totpValue,
+		PasswordRevisionDate: item.Login.PasswordRevisionDate,
+	}
+	tempItem.Identity = Identity{
+		Title:          item.Identity.Title,
+		FirstName:      item.Identity.FirstName,
+		MiddleName:     item.Identity.MiddleName,
+		LastName:       item.Identity.LastName,
+		Address1:       item.Identity.Address1,
+		Address2:       item.Identity.Address2,
+		Address3:       item.Identity.Address3,
+		City:           item.Identity.City,
+		State:          item.Identity.State,
+		PostalCode:     item.Identity.PostalCode,
+		Country:        item.Identity.Country,
+		Company:        item.Identity.Company,
+		Email:          item.Identity.Email,
+		Phone:          item.Identity.Email,
+		Ssn:            item.Identity.Ssn,
+		Username:       item.Identity.Username,
+		PassportNumber: item.Identity.PassportNumber,
+		LicenseNumber:  item.Identity.LicenseNumber,
+	}
+	var tempFields []Field
+	for _, field := range item.Fields {
+		if field.Type == 1 {
+			valueContent := "hidden"
+			if field.Value == "" {
+				valueContent = ""
 			}
-		}
-		tempItem.Fields = tempFields
-
-		// handling attchements slice here
-		var tempAttachments []Attachments
-		for _, att := range item.Attachments {
-			tempAttachments = append(tempAttachments, Attachments{
-				Id:       att.Id,
-				FileName: att.FileName,
-				Size:     att.Size,
-				SizeName: att.SizeName,
-				Url:      att.Url,
+			tempFields = append(tempFields, Field{
+				Name:  field.Name,
+				Value: valueContent,
+				Type:  field.Type,
+			})
+		} else {
+			tempFields = append(tempFields, Field{
+				Name:  field.Name,
+				Value: field.Value,
+				Type:  field.Type,
 			})
 		}
-		tempItem.Attachments = tempAttachments
+	}
+	tempItem.Fields = tempFields
 
-		// last step: appending cached items
-		cacheItems = append(cacheItems, tempItem)
+	// handling attchements slice here
+	var tempAttachments []Attachments
+	for _, att := range item.Attachments {
+		tempAttachments = append(tempAttachments, Attachments{
+			Id:       att.Id,
+			FileName: att.FileName,
+			Size:     att.Size,
+			SizeName: att.SizeName,
+			Url:      att.Url,
+		})
 	}
+	tempItem.Attachments = tempAttachments
 
-	debugLog(fmt.Sprintf("Total cacheItems # %d", len(cacheItems)))
+	return tempItem
+}
 
-	data, err := json.Marshal(cacheItems)
+// updateCachedItem applies update to the cached item with the given id
+// and encrypts the items cache again
+func updateCachedItem(id string, update func(item *Item)) error {
+	data, err := Decrypt()
 	if err != nil {
-		log.Println(err)
+		return err
 	}
-
-	Encrypt(data)
-
-	if conf.IconCacheEnabled && (wf.Data.Expired(ICON_CACHE_NAME, conf.IconMaxCacheAge) || !wf.Data.Exists(ICON_CACHE_NAME)) {
-		getIcon(wf)
+	var items []Item
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	if err := updateItem(items, id, update); err != nil {
+		return err
+	}
+	data, err = json.Marshal(items)
+	if err != nil {
+		return err
 	}
+	return Encrypt(data, len(items))
+}
 
-	// calculate to duration
-	elapsed := time.Since(start)
-	debugLog(fmt.Sprintf("Function exec time took %s", elapsed))
+// updateItem applies update to the item with the given id in items
+func updateItem(items []Item, id string, update func(item *Item)) error {
+	found := false
+	for i := range items {
+		if items[i].Id == id {
+			update(&items[i])
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("item %s not found in the items cache", id)
+	}
+	return nil
 }
 
 func getIcon(workflow *aw.Workflow) {
@@ -187,9 +356,10 @@ func getIcon(workflow *aw.Workflow) {
 		// start job
 		cmd := exec.Command(os.Args[0], "-icons")
 		log.Println("geticon cmd: ", cmd)
+		// the search calls it too, it mustn't fail because of the icons
 		if err := wf.RunInBackground("icons", cmd); err != nil {
-			log.Println(err)
-			wf.FatalError(err)
+			log.Printf("Couldn't start the icons job, error: %s", err)
+			return
 		}
 		log.Println("Started job icons: ", wf.IsRunning("icons"))
 		return
@@ -214,59 +384,41 @@ func populateCacheFolders(folders []Folder) {
 	}
 }
 
-func DownloadIcon(urlMap map[string]string, outputFolder string) {
-	//get https://icons.duckduckgo.com/ip3/maersk-analytics.atlassian.net.ico
-	//fullUrlFile = fmt.Sprintf("https://www.google.com/s2/favicons?domain=%s", urlString)
-	for id, url := range urlMap {
-		if !strings.HasPrefix(url, "http") {
-			url = fmt.Sprintf("http://%s", url)
-		}
-		u, err := tld.Parse(url)
-		if err != nil {
-			log.Println("Error parsing url: ", url, "error: ", err)
-			continue
-		}
-		if u.Host != "" {
-			url = u.Host
-			url = fmt.Sprintf("https://icons.duckduckgo.com/ip3/%s.ico", url)
-		}
-		filePath := fmt.Sprintf("%s/%s.png", outputFolder, id)
-		if _, err := os.Stat(filePath); err == nil {
-			log.Print("Skip downloading icon for url, most likely exists already: ", url)
-		} else {
-			err = DownloadFile(filePath, url)
-			if err != nil {
-				log.Print("Download icon error: ", err)
-			}
-		}
+func populateCacheCollections(collections []Collection) {
+	var cacheCollections []Collection
+	for _, collection := range collections {
+		cacheCollections = append(cacheCollections, Collection{
+			Object:         collection.Object,
+			Id:             collection.Id,
+			OrganizationId: collection.OrganizationId,
+			Name:           collection.Name,
+		})
 	}
-}
-
-// DownloadFile will download a url to a local file. It's efficient because it will
-// write as it downloads and not load the whole file into memory.
-func DownloadFile(filepath string, url string) error {
-	log.Println("Dowloading url: ", url, " to file: ", filepath)
 
-	// Get the data
-	resp, err := http.Get(url)
+	err := wf.Cache.StoreJSON(COLLECTION_CACHE_NAME, cacheCollections)
 	if err != nil {
-		return err
+		log.Println(err)
 	}
-	defer resp.Body.Close()
+}
 
-	// Create the file
-	out, err := os.Create(filepath)
-	if err != nil {
-		return err
+func populateCacheOrganizations(organizations []Organization) {
+	var cacheOrganizations []Organization
+	for _, organization := range organizations {
+		cacheOrganizations = append(cacheOrganizations, Organization{
+			Object:  organization.Object,
+			Id:      organization.Id,
+			Name:    organization.Name,
+			Enabled: organization.Enabled,
+		})
 	}
-	defer out.Close()
 
-	// Write the body to file
-	_, err = io.Copy(out, resp.Body)
-	return err
+	err := wf.Cache.StoreJSON(ORGANIZATION_CACHE_NAME, cacheOrganizations)
+	if err != nil {
+		log.Println(err)
+	}
 }
 
-func runGetIcons(url string, id string) {
+func runGetIcons(url string) {
 	log.Println("Background?", opts.Background)
 	if opts.Background {
 		if !wf.IsRunning("icons") {
@@ -282,46 +434,49 @@ func runGetIcons(url string, id string) {
 		return
 	}
 
-	urlIdMap := make(map[string]string)
-	if url == "" && id == "" {
-		// Load data
-		var items []Item
-		if wf.Cache.Exists(CACHE_NAME) {
-			data, err := Decrypt()
-			if err != nil {
-				log.Printf("Error decrypting data: %s", err)
-			}
-			if err := json.Unmarshal(data, &items); err != nil {
-				log.Printf("Couldn't load the items cache, error: %s", err)
-			}
-			for _, item := range items {
-				if item.Type == 1 {
-					if len(item.Login.Uris) > 0 {
-						urlIdMap[item.Id] = item.Login.Uris[0].Uri
-					}
-				}
-			}
+	urls := make(map[string]string)
+	queued := false
+	if url == "" && !conf.IconCacheEnabled {
+		// only the monograms are resolved
+		refreshItemIcons()
+		return
+	} else if url == "" && wf.Data.Exists(ICON_QUEUE_NAME) {
+		// only the icons of new domains since the last sync are fetched
+		if err := wf.Data.LoadJSON(ICON_QUEUE_NAME, &urls); err != nil {
+			log.Printf("Couldn't load the icon queue, error: %s", err)
 		}
-	} else {
-		urlIdMap[id] = url
+		if err := wf.Data.StoreJSON(ICON_QUEUE_NAME, nil); err != nil {
+			log.Println(err)
+		}
+		queued = true
+	} else if url == "" {
+		items, err := loadCachedItems()
+		if err != nil {
+			log.Printf("Couldn't load the items cache, error: %s", err)
+		}
+		_, urls = buildIconIndex(items)
+	} else if domain := iconDomain(url); domain != "" {
+		urls[domain] = url
 	}
 
-	// Marshal the map into a JSON string.
-	jsonMarshall, err := json.Marshal(urlIdMap)
+	outputFolder := iconDir()
+	if err := os.MkdirAll(outputFolder, os.ModePerm); err != nil {
+		log.Println(err)
+	}
+	downloader, err := newFaviconDownloader()
 	if err != nil {
-		log.Println(err.Error())
+		log.Printf("Couldn't download icons, error: %s", err)
 		return
 	}
-	jsonStr := string(jsonMarshall)
-
-	outputFolder := tilde.Abs(fmt.Sprintf("%s/urlicon", wf.DataDir()))
-	err = os.MkdirAll(outputFolder, os.ModePerm)
-	if err != nil {
-		log.Println(err)
+	result := downloader.download(urls, outputFolder)
+	log.Printf("Icons: %d downloaded, %d skipped, %d failed", result.Downloaded, result.Skipped, result.Failed)
+	// the search shows the new icons
+	refreshItemIcons()
+	if queued {
+		log.Printf("Finished downloading %d queued icons.", len(urls))
+		return
 	}
-	DownloadIcon(urlIdMap, outputFolder)
-	err = wf.Data.StoreJSON(ICON_CACHE_NAME, jsonStr)
-	if err != nil {
+	if err := wf.Data.StoreJSON(ICON_CACHE_NAME, fmt.Sprintf("%d icons", len(urls))); err != nil {
 		log.Println(err)
 	}
 	log.Println("Finished downloading icons.")
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"reflect"
 	"testing"
+	"time"
 )
 
 func Test_getItemTypeByName(t *testing.T) {
@@ -59,51 +61,81 @@ func Test_getItemTypeByName(t *testing.T) {
 	}
 }
 
-func Test_isItemIdFound(t *testing.T) {
-	type args struct {
-		itemId []string
-		item   Item
+func Test_mergeCacheItems(t *testing.T) {
+	rev := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	login := func(id, uri, password string, revision time.Time) Item {
+		return Item{Id: id, Type: 1, RevisionDate: revision, Login: Login{Password: password, Uris: []Uri{{Uri: uri}}}}
+	}
+	previous := map[string]Item{
+		"same":    login("same", "https://a.example", "hidden", rev),
+		"moved":   login("moved", "https://b.example", "hidden", rev),
+		"renamed": login("renamed", "https://c.example", "hidden", rev),
+		"nodate":  login("nodate", "https://d.example", "hidden", time.Time{}),
+		"gone":    login("gone", "https://e.example", "hidden", rev),
+	}
+	items := []Item{
+		login("same", "https://a.example", "secret", rev),
+		login("moved", "https://b2.example", "secret", rev.Add(time.Hour)),
+		login("renamed", "https://c.example", "secret", rev.Add(time.Hour)),
+		login("nodate", "https://d.example", "secret", time.Time{}),
+		login("new", "https://f.example", "secret", rev),
+		{Id: "multi", Type: 1, RevisionDate: rev, Login: Login{Uris: []Uri{
+			{Uri: "https://login.g.example/sso"}, {Uri: "androidapp://com.example"}, {Uri: "https://www.g.example"}, {Uri: "h.example"},
+		}}},
+		{Id: "note", Type: 2, RevisionDate: rev, Notes: "secret"},
+	}
+
+	got, diff, newDomains := mergeCacheItems(previous, items)
+	if want := (cacheDiff{Added: 3, Changed: 3, Deleted: 1, Unchanged: 1}); diff != want {
+		t.Errorf("mergeCacheItems() diff = %+v, want %+v", diff, want)
+	}
+	wantDomains := map[string]string{
+		"b2.example": "https://b2.example",
+		"f.example":  "https://f.example",
+		"g.example":  "https://login.g.example",
+		"h.example":  "http://h.example",
+	}
+	if !reflect.DeepEqual(newDomains, wantDomains) {
+		t.Errorf("mergeCacheItems() newDomains = %v, want %v", newDomains, wantDomains)
 	}
+	if len(got) != len(items) {
+		t.Fatalf("mergeCacheItems() returned %d items, want %d", len(got), len(items))
+	}
+	for i, item := range got {
+		if item.Id != items[i].Id {
+			t.Errorf("mergeCacheItems() item %d = %s, want %s", i, item.Id, items[i].Id)
+		}
+		if item.Login.Password == "secret" || item.Notes == "secret" {
+			t.Errorf("mergeCacheItems() item %s contains its secret", item.Id)
+		}
+	}
+}
+
+func Test_updateItem(t *testing.T) {
 	tests := []struct {
-		name string
-		args args
-		want bool
+		name     string
+		id       string
+		wantErr  bool
+		wantName []string
 	}{
-		{
-			name: "test note",
-			args: args{
-				itemId: []string{"note"},
-				item: Item{
-					Type: 2,
-				},
-			},
-			want: true,
-		},
-		{
-			name: "test login note",
-			args: args{
-				itemId: []string{"login", "note"},
-				item: Item{
-					Type: 4,
-				},
-			},
-			want: false,
-		},
-		{
-			name: "test card",
-			args: args{
-				itemId: []string{"card"},
-				item: Item{
-					Type: 3,
-				},
-			},
-			want: true,
-		},
+		{name: "found", id: "b", wantName: []string{"a", "updated"}},
+		{name: "not found", id: "c", wantErr: true, wantName: []string{"a", "b"}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := isItemIdFound(tt.args.itemId, tt.args.item); got != tt.want {
-				t.Errorf("isItemIdFound() = %v, want %v", got, tt.want)
+			items := []Item{{Id: "a", Name: "a"}, {Id: "b", Name: "b"}}
+			err := updateItem(items, tt.id, func(item *Item) {
+				item.Name = "updated"
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("updateItem() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var names []string
+			for _, item := range items {
+				names = append(names, item.Name)
+			}
+			if !reflect.DeepEqual(names, tt.wantName) {
+				t.Errorf("updateItem() names = %v, want %v", names, tt.wantName)
 			}
 		})
 	}
@@ -5,12 +5,14 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/blacs30/bitwarden-alfred-workflow/alfred"
@@ -26,33 +28,60 @@ var (
 // CLI flags
 type options struct {
 	// Commands
-	Search       bool
-	Config       bool
-	SetConfigs   bool
-	Auth         bool
-	OnOffConfigs bool
-	AuthConfig   bool
-	Lock         bool
-	Icons        bool
-	Folder       bool
-	Unlock       bool
-	Login        bool
-	Logout       bool
-	Sync         bool
-	Open         bool
-	GetItem      bool
+	Search           bool
+	Config           bool
+	SetConfigs       bool
+	Auth             bool
+	OnOffConfigs     bool
+	AuthConfig       bool
+	Lock             bool
+	Hibp             bool
+	TwofaDirectory   bool
+	Icons            bool
+	Folder           bool
+	Collection       bool
+	Unlock           bool
+	Login            bool
+	Logout           bool
+	Sync             bool
+	Open             bool
+	GetItem          bool
+	Send             bool
+	SendCreate       bool
+	SendDelete       bool
+	SendLink         bool
+	SendReceive      bool
+	AddAttachment    bool
+	DeleteAttachment bool
+	ConfirmDelete    bool
+	OpenAttachment   bool
+	WipeAttachments  bool
+	Saved            bool
+	SaveSearch       bool
+	DeleteSaved      bool
+	Usage            bool
+	ResetUsage       bool
+	Report           bool
+	Rotate           bool
+	Daemon           bool
+	InstallDaemon    bool
+	UninstallDaemon  bool
 
 	// Options
 	Force      bool
 	Totp       bool
 	Last       bool
 	Background bool
+	Clipboard  bool
+	File       bool
 
 	// Arguments
-	Id         string
-	Query      string
-	Attachment string
-	Output     string
+	Id          string
+	Query       string
+	Attachment  string
+	Path        string
+	SavedSearch string
+	Output      string
 }
 
 func init() {
@@ -65,9 +94,13 @@ func init() {
 	cli.BoolVar(&opts.Lock, "lock", false, "lock Bitwarden")
 	cli.BoolVar(&opts.Unlock, "unlock", false, "unlock Bitwarden")
 	cli.BoolVar(&opts.Icons, "icons", false, "Get favicons")
+	cli.BoolVar(&opts.Hibp, "hibp", false, "check the passwords against Have I Been Pwned")
+	cli.BoolVar(&opts.TwofaDirectory, "twofadirectory", false, "download the 2factorauth directory from TWOFA_DIRECTORY_URL")
 	cli.BoolVar(&opts.Folder, "folder", false, "Filter Bitwarden Folders")
+	cli.BoolVar(&opts.Collection, "collection", false, "Filter Bitwarden Collections")
 	cli.StringVar(&opts.Id, "id", "", "Get item by id")
 	cli.StringVar(&opts.Attachment, "attachment", "", "set attachment id")
+	cli.StringVar(&opts.Path, "path", "", "encoded folder path, lists the items in the folder and its subfolders")
 	cli.BoolVar(&opts.Login, "login", false, "login to Bitwarden")
 	cli.BoolVar(&opts.Logout, "logout", false, "logout Bitwarden")
 	cli.BoolVar(&opts.Sync, "sync", false, "sync secrets")
@@ -76,6 +109,29 @@ func init() {
 	cli.BoolVar(&opts.Force, "force", false, "force full sync")
 	cli.BoolVar(&opts.Totp, "totp", false, "get totp for item id")
 	cli.BoolVar(&opts.GetItem, "getitem", false, "get item and an object of it")
+	cli.BoolVar(&opts.Send, "send", false, "show/filter Bitwarden Sends")
+	cli.BoolVar(&opts.SendCreate, "sendcreate", false, "create a Send from the query")
+	cli.BoolVar(&opts.SendDelete, "senddelete", false, "delete the Send by id")
+	cli.BoolVar(&opts.SendLink, "sendlink", false, "get the link of the Send by id")
+	cli.BoolVar(&opts.SendReceive, "sendreceive", false, "receive the Send link in the query")
+	cli.BoolVar(&opts.AddAttachment, "addattachment", false, "upload the file path in the query as attachment to the item")
+	cli.BoolVar(&opts.DeleteAttachment, "deleteattachment", false, "delete attachment from the item")
+	cli.BoolVar(&opts.ConfirmDelete, "confirmdelete", false, "confirm the deletion of the attachment from the item")
+	cli.BoolVar(&opts.OpenAttachment, "openattachment", false, "open attachment from a private temporary folder")
+	cli.BoolVar(&opts.WipeAttachments, "wipeattachments", false, "wipe opened attachments after the timeout")
+	cli.BoolVar(&opts.Saved, "saved", false, "show/filter saved searches")
+	cli.BoolVar(&opts.SaveSearch, "savesearch", false, "save the query as named search")
+	cli.BoolVar(&opts.DeleteSaved, "deletesaved", false, "delete the saved search by id")
+	cli.StringVar(&opts.SavedSearch, "savedsearch", "", "start the search pre-filtered by the saved search with the id")
+	cli.BoolVar(&opts.Usage, "usage", false, "record the usage of the item by id")
+	cli.BoolVar(&opts.ResetUsage, "resetusage", false, "reset the usage history")
+	cli.BoolVar(&opts.Report, "report", false, "show the reports or run the report named in the query")
+	cli.BoolVar(&opts.Rotate, "rotate", false, "generate a new password for the item by id and open its login page")
+	cli.BoolVar(&opts.Daemon, "daemon", false, "run the daemon which locks after LOCK_TIMEOUT and syncs at AUTOSYNC_TIMES")
+	cli.BoolVar(&opts.InstallDaemon, "installdaemon", false, "install the LaunchAgent of the daemon")
+	cli.BoolVar(&opts.UninstallDaemon, "uninstalldaemon", false, "remove the LaunchAgent of the daemon")
+	cli.BoolVar(&opts.Clipboard, "clipboard", false, "create the Send from the clipboard")
+	cli.BoolVar(&opts.File, "file", false, "create the Send from the file path in the query")
 
 	cli.Usage = func() {
 		fmt.Fprint(os.Stderr, `usage: bitwarden-alfred-workflow [options] [arguments]
@@ -84,21 +140,45 @@ Alfred workflow to get secrets from Bitwarden.
 
 Usage:
     bitwarden-alfred-workflow [<query>]
+    bitwarden-alfred-workflow -addattachment -id <id> <path>
     bitwarden-alfred-workflow -auth [<query>]
+    bitwarden-alfred-workflow -collection [-id <id>] [<query>]
     bitwarden-alfred-workflow -conf [<query>]
-    bitwarden-alfred-workflow -folder [<query>]
+    bitwarden-alfred-workflow -confirmdelete -id <id> -attachment <id>
+    bitwarden-alfred-workflow -daemon
+    bitwarden-alfred-workflow -deletesaved -id <id>
+    bitwarden-alfred-workflow -deleteattachment -id <id> -attachment <id>
+    bitwarden-alfred-workflow -folder [-id <id>|-path <encoded path>] [<query>]
     bitwarden-alfred-workflow -getitem -id <id> [-totp] [-attachment <id>] [<query>] (query is used as jsonpath)
+    bitwarden-alfred-workflow -hibp [-background]
     bitwarden-alfred-workflow -icons [-background]
+    bitwarden-alfred-workflow -installdaemon
     bitwarden-alfred-workflow -lock
     bitwarden-alfred-workflow -login
     bitwarden-alfred-workflow -logout
     bitwarden-alfred-workflow -open [<query>]
+    bitwarden-alfred-workflow -openattachment -id <id> -attachment <id>
     bitwarden-alfred-workflow -output <query>
+    bitwarden-alfred-workflow -report [<report> [<query>]]
+    bitwarden-alfred-workflow -resetusage
+    bitwarden-alfred-workflow -rotate -id <id>
+    bitwarden-alfred-workflow -saved [<query>]
+    bitwarden-alfred-workflow -savedsearch <id> [<query>]
+    bitwarden-alfred-workflow -savesearch <query>
     bitwarden-alfred-workflow -search <query>
+    bitwarden-alfred-workflow -send [<query>]
+    bitwarden-alfred-workflow -sendcreate [-clipboard|-file] [<query>]
+    bitwarden-alfred-workflow -senddelete -id <id>
+    bitwarden-alfred-workflow -sendlink -id <id>
+    bitwarden-alfred-workflow -sendreceive <url>
     bitwarden-alfred-workflow -setsfaconfig [<setting>]
     bitwarden-alfred-workflow -authconfig [<query>]
     bitwarden-alfred-workflow -sync [-force|-last] [-background]
+    bitwarden-alfred-workflow -twofadirectory
+    bitwarden-alfred-workflow -uninstalldaemon
     bitwarden-alfred-workflow -unlock
+    bitwarden-alfred-workflow -usage -id <id>
+    bitwarden-alfred-workflow -wipeattachments
     bitwarden-alfred-workflow -h|-help
 
 Options:
@@ -107,6 +187,11 @@ Options:
 	}
 }
 
+// queryArgs joins all remaining arguments, Alfred passes the query unquoted
+func queryArgs() string {
+	return strings.Join(cli.Args(), " ")
+}
+
 func BitwardenAuthChecks() (loginErr error, unlockErr error) {
 	args := fmt.Sprintf("%s login --quiet --check", conf.BwExec)
 	if wf.Debug() {
@@ -273,6 +358,33 @@ func runConfig() {
 		Var("notification", "Syncing Bitwarden secrets").
 		Arg("-background")
 
+	wf.NewItem("Bitwarden Send").
+		Subtitle("List, create and receive Sends.").
+		Valid(true).
+		UID("send").
+		Icon(iconLink).
+		Var("action", "-send").
+		Var("title", "Bitwarden Send")
+
+	wf.NewItem("Saved Searches").
+		Subtitle("List, run and delete saved searches.").
+		Valid(true).
+		UID("saved").
+		Icon(iconStar).
+		Var("action", "-search").
+		Arg(conf.BwsavedKeyword)
+
+	wf.NewItem("Vault Reports").
+		Subtitle("Find reused passwords and other weak spots of the vault.").
+		Valid(true).
+		UID("report").
+		Icon(iconList).
+		Var("action", "-search").
+		Arg(conf.BwreportKeyword)
+
+	addExcludedItemsItem()
+	addDaemonItem()
+
 	wf.NewItem("Download/Update Favicon for URLs").
 		Subtitle("Downloads favicons for URLs").
 		Valid(true).
@@ -291,6 +403,14 @@ func runConfig() {
 		Var("notification", "Getting last sync date.").
 		Arg("-last")
 
+	wf.NewItem("Reset usage history").
+		Subtitle("Forget which items were used recently, results are ranked in vault order again.").
+		Valid(true).
+		UID("resetusage").
+		Icon(iconReload).
+		Var("action", "-resetusage").
+		Var("notification", "Resetting usage history")
+
 	if opts.Query != "" {
 		wf.Filter(opts.Query)
 	}
@@ -299,6 +419,71 @@ func runConfig() {
 	wf.SendFeedback()
 }
 
+// addDaemonItem shows whether the daemon runs and what it does
+func addDaemonItem() {
+	status, err := loadDaemonStatus()
+	if err != nil {
+		log.Printf("Couldn't load the daemon status, error: %s", err)
+	}
+	now := time.Now()
+	if !status.running(now) {
+		wf.NewItem("Daemon: not running").
+			Subtitle("Install it to lock after LOCK_TIMEOUT minutes without use and to sync at AUTOSYNC_TIMES.").
+			Valid(true).
+			UID("daemon").
+			Icon(iconOff).
+			Var("action", "-search").
+			Arg(conf.BwautoKeyword)
+		return
+	}
+	var details []string
+	if status.LockAfter > 0 {
+		details = append(details, fmt.Sprintf("locks after %d minutes without use", status.LockAfter))
+	}
+	if !status.NextSync.IsZero() {
+		details = append(details, fmt.Sprintf("next sync %s", status.NextSync.Format("Mon 15:04")))
+	}
+	if !status.LastSync.IsZero() {
+		details = append(details, fmt.Sprintf("last sync %s", status.LastSync.Format("Mon 15:04")))
+	}
+	if status.ScheduleError != "" {
+		details = append(details, fmt.Sprintf("invalid AUTOSYNC_TIMES: %s", status.ScheduleError))
+	}
+	if status.Error != "" {
+		details = append(details, fmt.Sprintf("error: %s", status.Error))
+	}
+	wf.NewItem("Daemon: running").
+		Subtitle(strings.Join(details, ", ")).
+		Valid(true).
+		UID("daemon").
+		Icon(iconOn).
+		Var("action", "-search").
+		Arg(conf.BwautoKeyword)
+}
+
+// addExcludedItemsItem shows how many items SKIP_TYPES and the EXCLUDE_* rules kept out of the cache at the last sync
+func addExcludedItemsItem() {
+	excluded := map[string]int{}
+	if wf.Cache.Exists(EXCLUDED_CACHE_NAME) {
+		if err := wf.Cache.LoadJSON(EXCLUDED_CACHE_NAME, &excluded); err != nil {
+			log.Printf("Couldn't load the excluded items count, error: %s", err)
+		}
+	}
+	total := 0
+	for _, count := range excluded {
+		total += count
+	}
+	subtitle := "No items are excluded by SKIP_TYPES or the EXCLUDE_* rules."
+	if total > 0 {
+		subtitle = fmt.Sprintf("Not cached and not searchable: %s.", exclusionSummary(excluded))
+	}
+	wf.NewItem(fmt.Sprintf("Excluded Items: %d", total)).
+		Subtitle(subtitle).
+		Valid(false).
+		UID("excluded").
+		Icon(iconInfoCircle)
+}
+
 // Open path/URL
 func runOpen() {
 	wf.Configure(aw.TextErrors(true))
@@ -310,6 +495,7 @@ func runOpen() {
 	if _, err := util.RunCmd(cmd); err != nil {
 		wf.Fatalf("/usr/bin/open %q: %v", opts.Query, err)
 	}
+	recordUsage(opts.Id)
 }
 
 // Filter auth config in Alfred
@@ -555,17 +741,28 @@ func runSearch(folderSearch bool, itemId string) {
 	wf.Configure(aw.SuppressUIDs(true))
 	if bwData.UserId == "" {
 		message := "Need to login first."
-		if wf.Cache.Exists(CACHE_NAME) && wf.Cache.Exists(FOLDER_CACHE_NAME) {
+		if wf.Cache.Exists(CACHE_NAME) && wf.Cache.Exists(FOLDER_CACHE_NAME) && !conf.CacheKeyFromSession {
 			message = "Need to login first to get secrets, reading cached items without the secret."
 		}
 		wf.NewWarningItem("Not logged in to Bitwarden.", message)
 		addLoginItem(email, sfaMode)
+		if conf.CacheKeyFromSession {
+			wf.SendFeedback()
+			return
+		}
 	}
 
 	if bwData.UserId != "" && bwData.ProtectedKey == "" {
 		message := "Need to unlock first to get secrets, reading cached items without the secrets."
+		if conf.CacheKeyFromSession {
+			message = LOCKED_CACHE_MSG
+		}
 		wf.NewWarningItem("Bitwarden is locked.", message)
 		addUnlockItem(email)
+		if conf.CacheKeyFromSession {
+			wf.SendFeedback()
+			return
+		}
 	}
 
 	if conf.ReorderingDisabled {
@@ -579,20 +776,47 @@ func runSearch(folderSearch bool, itemId string) {
 	// Load data
 	var items []Item
 	var folders []Folder
+	var collections []Collection
+	var organizations []Organization
 
 	// check if the data cache exists
 	if wf.Cache.Exists(CACHE_NAME) && wf.Cache.Exists(FOLDER_CACHE_NAME) {
 		data, err := Decrypt()
+		if errors.Is(err, errCacheLocked) {
+			if bwData.UserId != "" && bwData.ProtectedKey != "" {
+				// the vault is unlocked but the session isn't in the keychain
+				wf.NewWarningItem("Bitwarden is locked.", LOCKED_CACHE_MSG)
+				addUnlockItem(email)
+			}
+			wf.SendFeedback()
+			return
+		}
+		if isCacheInvalid(err) {
+			addRebuildingCacheItem(err, rebuildCache(err))
+			wf.SendFeedback()
+			return
+		}
 		if err != nil {
 			log.Printf("Error decrypting data: %s", err)
-		}
-		if err := json.Unmarshal(data, &items); err != nil {
+		} else if err := json.Unmarshal(data, &items); err != nil {
 			log.Printf("Couldn't load the items cache, error: %s", err)
 		}
 		if err := wf.Cache.LoadJSON(FOLDER_CACHE_NAME, &folders); err != nil {
 			log.Printf("Couldn't load the folders cache, error: %s", err)
 		}
 	}
+	// collections and organizations are only cached if the account has some
+	if wf.Cache.Exists(COLLECTION_CACHE_NAME) {
+		if err := wf.Cache.LoadJSON(COLLECTION_CACHE_NAME, &collections); err != nil {
+			log.Printf("Couldn't load the collections cache, error: %s", err)
+		}
+	}
+	if wf.Cache.Exists(ORGANIZATION_CACHE_NAME) {
+		if err := wf.Cache.LoadJSON(ORGANIZATION_CACHE_NAME, &organizations); err != nil {
+			log.Printf("Couldn't load the organizations cache, error: %s", err)
+		}
+	}
+	ctx := newSearchContext(folders, collections, organizations)
 
 	// Check if the sync cache exists
 	if !wf.Cache.Exists(SYNC_CACHE_NAME) && !wf.Cache.Exists(CACHE_NAME) {
@@ -632,6 +856,9 @@ func runSearch(folderSearch bool, itemId string) {
 		return
 	}
 
+	// the cached items are shown while a sync updates them in the background
+	refreshing := autoSync()
+
 	// set lastUsageCache after all the config and auth options and cache checks ran
 	// it's only set when a search  is successfully ready to be executed
 	timestamp := time.Now().Unix()
@@ -640,25 +867,26 @@ func runSearch(folderSearch bool, itemId string) {
 		log.Println(err)
 	}
 
-	if folderSearch && itemId == "" {
+	if folderSearch && itemId == "" && opts.Path == "" {
 		runSearchFolder(items, folders)
+		return
 	}
 
-	autoFetchCache := false
-	if wf.Cache.Expired(AUTO_FETCH_CACHE, conf.AutoFetchIconMaxCacheAge) || !wf.Cache.Exists(AUTO_FETCH_CACHE) {
-		autoFetchCache = true
-		err := wf.Cache.Store(AUTO_FETCH_CACHE, []byte(string("auto-fetch-cache")))
-		if err != nil {
+	// missing favicons are fetched and the icons resolved by the icons job, never by the search itself
+	autoFetch := conf.IconCacheEnabled && (wf.Cache.Expired(AUTO_FETCH_CACHE, conf.AutoFetchIconMaxCacheAge) || !wf.Cache.Exists(AUTO_FETCH_CACHE))
+	if autoFetch || (len(items) > 0 && !wf.Data.Exists(ICON_PATHS_NAME)) {
+		if err := wf.Cache.Store(AUTO_FETCH_CACHE, []byte(string("auto-fetch-cache"))); err != nil {
 			log.Println(err)
 		}
+		getIcon(wf)
 	}
 
-	if itemId != "" && !folderSearch {
+	if itemId != "" && !folderSearch && !opts.Collection {
 		log.Printf(`showing items for id "%s" ...`, itemId)
 		// Add item to workflow for itemId
 		for _, item := range items {
 			if item.Id == itemId {
-				addItemDetails(item, autoFetchCache)
+				addItemDetails(item, ctx)
 
 				if opts.Query != "" {
 					log.Printf(`searching for "%s" ...`, opts.Query)
@@ -673,87 +901,187 @@ func runSearch(folderSearch bool, itemId string) {
 		}
 	}
 
-	if itemId != "" && folderSearch {
-		log.Printf(`searching in folder with id "%s" ...`, itemId)
-		// Add item to search folders
-		wf.NewItem("Back to folder search.").
-			Subtitle("Go back.").Valid(true).
-			UID("").
-			Icon(iconFolder).
-			Var("action", "-search").
-			Arg(conf.BwfKeyword)
-		addBackToNormalSearchItem()
-		for _, item := range items {
-			if item.FolderId == itemId {
-				addItemsToWorkflow(item, autoFetchCache)
+	// qualifiers like "type:login" filter the items, the remaining text is filtered as usual
+	query := queryArgs()
+	if opts.SavedSearch != "" {
+		searches, err := loadSavedSearches()
+		if err != nil {
+			log.Printf("Couldn't load the saved searches, error: %s", err)
+		}
+		query = savedSearchQuery(searches, opts.SavedSearch, query)
+	}
+	search := parseSearchQuery(query)
+	searchText := search.Text
+	if len(search.Qualifiers) > 0 {
+		log.Printf("filtering items by %q", search)
+		items = filterItems(items, search, ctx)
+	}
+	if conf.SecureNotesByKeywordOnly {
+		items = withoutSecureNotes(items, search)
+	}
+
+	if opts.Collection {
+		runSearchCollection(items, collections, ctx, itemId, searchText)
+		return
+	}
+
+	if folderSearch && (itemId != "" || opts.Path != "") {
+		var itemsInFolder []Item
+		path := ctx.Folders[itemId]
+		if opts.Path != "" {
+			var err error
+			path, err = decodeFolderPath(opts.Path)
+			if err != nil {
+				wf.FatalError(err)
+				return
 			}
-			if itemId == "null" {
-				if item.FolderId == "" {
-					addItemsToWorkflow(item, autoFetchCache)
+			log.Printf(`searching in folder "%s" and its subfolders ...`, path)
+			itemsInFolder = folderItems(folders, items, path, true)
+		} else {
+			log.Printf(`searching in folder with id "%s" ...`, itemId)
+			for _, item := range items {
+				if item.FolderId == itemId || (itemId == "null" && item.FolderId == "") {
+					itemsInFolder = append(itemsInFolder, item)
 				}
 			}
 		}
-	}
+		if searchText == "" {
+			// Add item to search folders, it opens the level of the folder
+			wf.NewItem("Back to folder search.").
+				Subtitle(fmt.Sprintf("Go back to %s.", folderBreadcrumbs(parentFolderPath(path)))).Valid(true).
+				UID("").
+				Icon(iconFolder).
+				Var("action", "-search").
+				Arg(strings.TrimSpace(fmt.Sprintf("%s %s", conf.BwfKeyword, folderLevelQuery(parentFolderPath(path)))))
+			addBackToNormalSearchItem()
+		}
+		addSearchResultsToWorkflow(itemsInFolder, searchText, false)
 
-	if len(items) == 0 && len(folders) == 0 {
-		wf.NewItem("No Secrets Found").Subtitle("Try a different query or sync manually.").Icon(iconWarning).Valid(false)
+		folderQualifier := searchQualifier{Key: "folder", Value: path}
+		if itemId == "null" {
+			folderQualifier.Value = "none"
+		}
+		addSaveSearchItem(searchQuery{Text: query, Qualifiers: []searchQualifier{folderQualifier}}.String())
 	}
 
 	if !folderSearch && itemId == "" {
-		// Add item to search folders
-		wf.NewItem("Search Folders").
-			Subtitle("Find folders and secrets in them.").Valid(true).
-			UID("").
-			Icon(iconFolder).
-			Var("action", "-search").
-			Arg(conf.BwfKeyword)
+		if searchText == "" {
+			// Add item to search folders
+			wf.NewItem("Search Folders").
+				Subtitle("Find folders and secrets in them.").Valid(true).
+				UID("").
+				Icon(iconFolder).
+				Var("action", "-search").
+				Arg(conf.BwfKeyword)
+			if len(collections) > 0 {
+				wf.NewItem("Search Collections").
+					Subtitle("Find organization collections and secrets in them.").Valid(true).
+					UID("").
+					Icon(iconBoxes).
+					Var("action", "-search").
+					Arg(conf.BwcKeyword)
+			}
+		}
 
 		log.Printf("Number of items %d", len(items))
-		for _, item := range items {
-			addItemsToWorkflow(item, autoFetchCache)
+		addSearchResultsToWorkflow(items, searchText, true)
+		if opts.SavedSearch == "" {
+			addSaveSearchItem(query)
 		}
 	}
+	if refreshing {
+		addRefreshingItem()
+	}
+	wf.SendFeedback()
+}
 
-	if opts.Query != "" {
-		log.Printf(`searching for "%s" ...`, opts.Query)
-		res := wf.Filter(opts.Query)
-		for _, r := range res {
-			log.Printf("[search] %0.2f %#v", r.Score, r.SortKey)
+// addSearchResultsToWorkflow adds the items matching the search text, ordered by the weighted search index
+// and the usage history. The title isn't used for matching, so TITLE_WITH_USER and TITLE_WITH_URLS don't change the results.
+// Without search text the recently used items are shown first if showRecent is set.
+func addSearchResultsToWorkflow(items []Item, searchText string, showRecent bool) {
+	history := loadUsageHistoryForSearch()
+	now := time.Now()
+	found := len(items) > 0
+	if searchText == "" {
+		recent := map[string]bool{}
+		if showRecent && conf.RecentlyUsedCount > 0 {
+			for _, id := range history.recent(conf.RecentlyUsedCount) {
+				for _, item := range items {
+					if item.Id == id {
+						recent[id] = true
+						addItemsToWorkflow(item, "Recently used")
+						break
+					}
+				}
+			}
 		}
+		for _, item := range sortByUsage(items, history, now) {
+			if !recent[item.Id] {
+				addItemsToWorkflow(item, "")
+			}
+		}
+	} else {
+		log.Printf(`searching for "%s" ...`, searchText)
+		index := newSearchIndex(items, conf.SearchFieldWeights)
+		results := index.Search(searchText)
+		rankByUsage(results, history, now)
+		for _, r := range results {
+			debugLog(fmt.Sprintf("[search] %0.2f %s (%s)", r.Score, r.Item.Name, r.Matched.Kind))
+			matched := ""
+			if label := r.matchedLabel(); label != "" {
+				matched = fmt.Sprintf("Matched %s", label)
+			}
+			addItemsToWorkflow(r.Item, matched)
+		}
+		found = len(results) > 0
+	}
+	if !found {
+		wf.NewItem("No Secrets Found").Subtitle("Try a different query or sync manually.").Icon(iconWarning).Valid(false)
 	}
-	wf.SendFeedback()
 }
 
-// Filter Bitwarden secrets in Alfred
-func runSearchFolder(items []Item, folders []Folder) {
-	if opts.Query != "" {
-		log.Printf(`searching for "%s" ...`, opts.Query)
+// runSearchCollection lists the collections, or the items of the collection with the id collectionId
+func runSearchCollection(items []Item, collections []Collection, ctx searchContext, collectionId string, searchText string) {
+	if collectionId != "" {
+		log.Printf(`searching in collection with id "%s" ...`, collectionId)
+		if searchText == "" {
+			wf.NewItem("Back to collection search.").
+				Subtitle("Go back.").Valid(true).
+				UID("").
+				Icon(iconBoxes).
+				Var("action", "-search").
+				Arg(conf.BwcKeyword)
+			addBackToNormalSearchItem()
+		}
+		var collectionItems []Item
+		for _, item := range items {
+			for _, id := range item.CollectionIds {
+				if id == collectionId {
+					collectionItems = append(collectionItems, item)
+					break
+				}
+			}
+		}
+		addSearchResultsToWorkflow(collectionItems, searchText, false)
+		wf.SendFeedback()
+		return
 	}
 
 	addBackToNormalSearchItem()
 
-	log.Printf("Number of folders %d", len(folders))
-	for _, folder := range folders {
-		itemCount := getItemsInFolderCount(folder.Id, items)
-		id := "null"
-		if folder.Id != "" {
-			id = folder.Id
-		}
-		if opts.Query != "" {
-			wf.NewItem(folder.Name).
-				Subtitle(fmt.Sprintf("Number of items: %d", itemCount)).Valid(true).
-				UID(id).
-				Icon(iconFolderOpen).
-				Var("action", "-folder").
-				Var("action2", fmt.Sprintf("-id %s ", id))
-		} else {
-			wf.NewItem(folder.Name).
-				Subtitle(fmt.Sprintf("Number of items: %d", itemCount)).Valid(true).
-				UID(id).
-				Icon(iconFolderOpen).
-				Var("action", "-folder").
-				Var("action2", fmt.Sprintf("-id %s ", id))
+	log.Printf("Number of collections %d", len(collections))
+	for _, collection := range collections {
+		itemCount := getItemsInCollectionCount(collection.Id, items)
+		subtitle := fmt.Sprintf("Number of items: %d", itemCount)
+		if org := ctx.Organizations[collection.OrganizationId]; org != "" {
+			subtitle = fmt.Sprintf("%s, organization: %s", subtitle, org)
 		}
+		wf.NewItem(collection.Name).
+			Subtitle(subtitle).Valid(true).
+			UID(collection.Id).
+			Icon(iconBoxes).
+			Var("action", "-collection").
+			Var("action2", fmt.Sprintf("-id %s ", collection.Id))
 	}
 
 	if opts.Query != "" {
@@ -763,6 +1091,29 @@ func runSearchFolder(items []Item, folders []Folder) {
 		}
 	}
 
+	wf.WarnEmpty("No Collections Found", "Try a different query or sync manually.")
+	wf.SendFeedback()
+}
+
+// Filter Bitwarden folders in Alfred, one level of the folder tree at a time
+func runSearchFolder(items []Item, folders []Folder) {
+	query := queryArgs()
+	filter := query
+	if query == "" || strings.Contains(query, folderSeparator) {
+		filter = addFolderLevelItems(items, folders, query)
+	} else {
+		// a query without a path searches the whole tree
+		addAllFoldersItems(items, folders)
+	}
+
+	if filter != "" {
+		log.Printf(`searching for "%s" ...`, filter)
+		res := wf.Filter(filter)
+		for _, r := range res {
+			log.Printf("[search] %0.2f %#v", r.Score, r.SortKey)
+		}
+	}
+
 	if len(items) == 0 && len(folders) == 0 {
 		wf.WarnEmpty("No Secrets Found", "Try a different query or sync manually.")
 	}
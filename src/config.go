@@ -213,10 +213,23 @@ func loadConfig() {
 	autoFetchIconCacheAgeDuration := time.Duration(conf.AutoFetchIconCacheAge)
 	conf.AutoFetchIconMaxCacheAge = autoFetchIconCacheAgeDuration * time.Minute
 
+	attachmentOpenTimeoutDuration := time.Duration(conf.AttachmentOpenTimeout)
+	conf.AttachmentMaxOpenAge = attachmentOpenTimeoutDuration * time.Minute
+
+	syncMaxAgeDuration := time.Duration(conf.SyncMaxAge)
+	conf.SyncMaxCacheAge = syncMaxAgeDuration * time.Minute
+
+	// parsed once, every item of the search uses them
+	conf.SearchFieldWeights = parseSearchWeights(conf.SearchWeights)
+
 	conf.BwauthKeyword = os.Getenv("bwauth_keyword")
 	conf.BwconfKeyword = os.Getenv("bwconf_keyword")
 	conf.BwKeyword = os.Getenv("bw_keyword")
 	conf.BwfKeyword = os.Getenv("bwf_keyword")
+	conf.BwcKeyword = os.Getenv("bwc_keyword")
+	conf.BwreportKeyword = os.Getenv("bwreport_keyword")
+	conf.BwsavedKeyword = os.Getenv("bwsaved_keyword")
+	conf.BwautoKeyword = os.Getenv("bwauto_keyword")
 
 	initModifiers()
 }
@@ -423,7 +436,7 @@ func setModAction(itemConfig itemsModifierActionRelationMap, item Item, itemType
 					Subtitle:     subtitle,
 					Notification: notification,
 					Action:       loginUrlAction,
-					Action2:      " ",
+					Action2:      fmt.Sprintf("-id %s", item.Id),
 					Action3:      " ",
 					Arg:          item.Login.Uris[0].Uri,
 					Icon:         assignedIcon,
@@ -464,7 +477,7 @@ func setModAction(itemConfig itemsModifierActionRelationMap, item Item, itemType
 				Action2:      fmt.Sprintf("-id %s", item.Id),
 				Action3:      " ",
 				Arg:          "notes",
-				Icon:         iconNote,
+				Icon:         icon,
 				ActionName:   "",
 			}
 			setItemMod(itemConfig, modItem, itemType, "nomod")
@@ -485,7 +498,9 @@ func setModAction(itemConfig itemsModifierActionRelationMap, item Item, itemType
 
 			if action == "card" {
 				subtitle := "Copy Card Number"
+				assignedIcon := iconCreditCard
 				if modMode == "nomod" {
+					assignedIcon = icon
 					subtitle = fmt.Sprintf("%s, %s, ↩ or ⇥ copy Card Number, %s copy Security Code, %s show more, %s open in WebUI", item.Card.Brand, item.Card.Number, codeEmoji, moreEmoji, webUiEmoji)
 				}
 				modItem := modifierActionContent{
@@ -496,7 +511,7 @@ func setModAction(itemConfig itemsModifierActionRelationMap, item Item, itemType
 					Action2:      fmt.Sprintf("-id %s", item.Id),
 					Action3:      " ",
 					Arg:          "card.number",
-					Icon:         iconCreditCard,
+					Icon:         assignedIcon,
 					ActionName:   action,
 				}
 				setItemMod(itemConfig, modItem, itemType, modMode)
@@ -508,7 +523,7 @@ func setModAction(itemConfig itemsModifierActionRelationMap, item Item, itemType
 				}
 				assignedIcon := iconPassword
 				if modMode == "nomod" {
-					assignedIcon = iconCreditCard
+					assignedIcon = icon
 				}
 				modItem := modifierActionContent{
 					Title:        title,
@@ -533,7 +548,7 @@ func setModAction(itemConfig itemsModifierActionRelationMap, item Item, itemType
 				Action2:      " ",
 				Action3:      " ",
 				Arg:          " ",
-				Icon:         iconIdBatch,
+				Icon:         icon,
 				ActionName:   "",
 			}
 			setItemMod(itemConfig, modItem, itemType, "nomod")
@@ -566,7 +581,7 @@ func setModAction(itemConfig itemsModifierActionRelationMap, item Item, itemType
 				Subtitle:     subtitle,
 				Notification: " ",
 				Action:       "-open",
-				Action2:      " ",
+				Action2:      fmt.Sprintf("-id %s", item.Id),
 				Action3:      " ",
 				Arg:          fmt.Sprintf("%s/#/vault?itemId=%s", webUi, item.Id),
 				Icon:         iconBw,
@@ -32,46 +32,89 @@ type itemsModifierActionRelationMap = map[string]map[string]modifierActionRelati
 
 type config struct {
 	// From workflow environment variables
+	AttachmentOpenTimeout    int `envconfig:"ATTACHMENT_OPEN_TIMEOUT" default:"5"`
+	AttachmentMaxOpenAge     time.Duration
 	AutoFetchIconCacheAge    int `default:"1440" split_words:"true"`
 	AutoFetchIconMaxCacheAge time.Duration
+	AutoHour                 string `envconfig:"AUTO_HOUR" default:""`
+	AutoMin                  string `envconfig:"AUTO_MIN" default:""`
+	AutosyncJitter           int    `envconfig:"AUTOSYNC_JITTER" default:"5"`
+	AutosyncTimes            string `envconfig:"AUTOSYNC_TIMES" default:""`
 	BwconfKeyword            string
 	BwauthKeyword            string
 	BwKeyword                string
 	BwfKeyword               string
+	BwcKeyword               string
+	BwreportKeyword          string
+	BwsavedKeyword           string
+	BwautoKeyword            string
 	BwExec                   string `split_words:"true"`
 	// BwDataPath default is set in loadBitwardenJSON()
-	BwDataPath         string `envconfig:"BW_DATA_PATH"`
-	Debug              bool   `envconfig:"DEBUG" default:"false"`
-	Email              string
-	EmailMaxWait       int  `envconfig:"EMAIL_MAX_WAIT" default:"15"`
-	EmptyDetailResults bool `default:"false" split_words:"true"`
-	IconCacheAge       int  `default:"43200" split_words:"true"`
-	IconCacheEnabled   bool `default:"true" split_words:"true"`
-	IconMaxCacheAge    time.Duration
-	MaxResults         int    `default:"1000" split_words:"true"`
-	Mod1               string `envconfig:"MODIFIER_1" default:"alt"`
-	Mod1Action         string `envconfig:"MODIFIER_1_ACTION" default:"username,code"`
-	Mod2               string `envconfig:"MODIFIER_2" default:"shift"`
-	Mod2Action         string `envconfig:"MODIFIER_2_ACTION" default:"url"`
-	Mod3               string `envconfig:"MODIFIER_3" default:"cmd"`
-	Mod3Action         string `envconfig:"MODIFIER_3_ACTION" default:"totp"`
-	Mod4               string `envconfig:"MODIFIER_4" default:"cmd,alt,ctrl"`
-	Mod4Action         string `envconfig:"MODIFIER_4_ACTION" default:"more"`
-	Mod5               string `envconfig:"MODIFIER_5" default:"cmd,shift"`
-	Mod5Action         string `envconfig:"MODIFIER_5_ACTION" default:"webui"`
-	NoModAction        string `envconfig:"NO_MODIFIER_ACTION" default:"password,card"`
-	OpenLoginUrl       bool   `envconfig:"OPEN_LOGIN_URL" default:"true"`
-	OutputFolder       string `default:"" split_words:"true"`
-	Path               string
-	ReorderingDisabled bool   `default:"true" split_words:"true"`
-	Server             string `envconfig:"SERVER_URL" default:"https://bitwarden.com"`
-	Sfa                bool   `envconfig:"2FA_ENABLED" default:"true"`
-	SfaMode            int    `envconfig:"2FA_MODE" default:"0"`
-	SkipTypes          string `envconfig:"SKIP_TYPES" default:""`
-	TitleWithUser      bool   `envconfig:"TITLE_WITH_USER" default:"true"`
-	TitleWithUrls      bool   `envconfig:"TITLE_WITH_URLS" default:"true"`
-	UseApikey          bool   `envconfig:"USE_APIKEY" default:"false"`
-	WebUiURL           string `envconfig:"WEBUI_URL" default:"https://vault.bitwarden.com"`
+	BwDataPath               string `envconfig:"BW_DATA_PATH"`
+	CacheKeyFromSession      bool   `envconfig:"CACHE_KEY_FROM_SESSION" default:"false"`
+	Debug                    bool   `envconfig:"DEBUG" default:"false"`
+	Email                    string
+	EmailMaxWait             int    `envconfig:"EMAIL_MAX_WAIT" default:"15"`
+	EmptyDetailResults       bool   `default:"false" split_words:"true"`
+	ExcludeCollections       string `envconfig:"EXCLUDE_COLLECTIONS" default:""`
+	ExcludeFolders           string `envconfig:"EXCLUDE_FOLDERS" default:""`
+	ExcludeNameRegex         string `envconfig:"EXCLUDE_NAME_REGEX" default:""`
+	ExcludeOrganizations     string `envconfig:"EXCLUDE_ORGANIZATIONS" default:""`
+	HibpApiUrl               string `envconfig:"HIBP_API_URL" default:"https://api.pwnedpasswords.com"`
+	HibpMirror               string `envconfig:"HIBP_MIRROR" default:""`
+	HibpRequestInterval      int    `envconfig:"HIBP_REQUEST_INTERVAL" default:"100"`
+	IconCacheAge             int    `default:"43200" split_words:"true"`
+	IconCacheEnabled         bool   `default:"true" split_words:"true"`
+	IconDownloadRetries      int    `envconfig:"ICON_DOWNLOAD_RETRIES" default:"2"`
+	IconDownloadTimeout      int    `envconfig:"ICON_DOWNLOAD_TIMEOUT" default:"10"`
+	IconDownloadWorkers      int    `envconfig:"ICON_DOWNLOAD_WORKERS" default:"8"`
+	IconMaxCacheAge          time.Duration
+	IconMaxSize              int    `envconfig:"ICON_MAX_SIZE" default:"256"`
+	IconProviders            string `envconfig:"ICON_PROVIDERS" default:"duckduckgo"`
+	IconUrlTemplate          string `envconfig:"ICON_URL_TEMPLATE" default:""`
+	LockTimeout              int    `envconfig:"LOCK_TIMEOUT" default:"0"`
+	MaxResults               int    `default:"1000" split_words:"true"`
+	MonogramIcons            bool   `envconfig:"MONOGRAM_ICONS" default:"true"`
+	Mod1                     string `envconfig:"MODIFIER_1" default:"alt"`
+	Mod1Action               string `envconfig:"MODIFIER_1_ACTION" default:"username,code"`
+	Mod2                     string `envconfig:"MODIFIER_2" default:"shift"`
+	Mod2Action               string `envconfig:"MODIFIER_2_ACTION" default:"url"`
+	Mod3                     string `envconfig:"MODIFIER_3" default:"cmd"`
+	Mod3Action               string `envconfig:"MODIFIER_3_ACTION" default:"totp"`
+	Mod4                     string `envconfig:"MODIFIER_4" default:"cmd,alt,ctrl"`
+	Mod4Action               string `envconfig:"MODIFIER_4_ACTION" default:"more"`
+	Mod5                     string `envconfig:"MODIFIER_5" default:"cmd,shift"`
+	Mod5Action               string `envconfig:"MODIFIER_5_ACTION" default:"webui"`
+	NoModAction              string `envconfig:"NO_MODIFIER_ACTION" default:"password,card"`
+	OpenLoginUrl             bool   `envconfig:"OPEN_LOGIN_URL" default:"true"`
+	OutputFolder             string `default:"" split_words:"true"`
+	PasswordAgePolicy        string `envconfig:"PASSWORD_AGE_POLICY" default:""`
+	PasswordMaxAge           int    `envconfig:"PASSWORD_MAX_AGE" default:"365"`
+	Path                     string
+	RecentlyUsedCount        int    `envconfig:"RECENTLY_USED_COUNT" default:"5"`
+	ReorderingDisabled       bool   `default:"true" split_words:"true"`
+	RotatePasswordLength     int    `envconfig:"ROTATE_PASSWORD_LENGTH" default:"24"`
+	SearchWeights            string `envconfig:"SEARCH_WEIGHTS" default:"name:10,username:6,uri:5,field:3,identity:2,card:2"`
+	SearchFieldWeights       map[string]float64
+	SendExpirationDays       int    `envconfig:"SEND_EXPIRATION_DAYS" default:"7"`
+	SendHideEmail            bool   `envconfig:"SEND_HIDE_EMAIL" default:"false"`
+	SecureNotesByKeywordOnly bool   `envconfig:"SECURE_NOTES_BY_KEYWORD_ONLY" default:"false"`
+	SendMaxAccessCount       int    `envconfig:"SEND_MAX_ACCESS_COUNT" default:"0"`
+	Server                   string `envconfig:"SERVER_URL" default:"https://bitwarden.com"`
+	Sfa                      bool   `envconfig:"2FA_ENABLED" default:"true"`
+	SfaMode                  int    `envconfig:"2FA_MODE" default:"0"`
+	SkipTypes                string `envconfig:"SKIP_TYPES" default:""`
+	SyncMaxAge               int    `envconfig:"SYNC_MAX_AGE" default:"0"`
+	SyncMaxCacheAge          time.Duration
+	TitleWithUser            bool   `envconfig:"TITLE_WITH_USER" default:"true"`
+	TitleWithUrls            bool   `envconfig:"TITLE_WITH_URLS" default:"true"`
+	TwofaDirectoryFile       string `envconfig:"TWOFA_DIRECTORY_FILE" default:""`
+	TwofaDirectoryRefresh    int    `envconfig:"TWOFA_DIRECTORY_REFRESH" default:"0"`
+	TwofaDirectoryUrl        string `envconfig:"TWOFA_DIRECTORY_URL" default:"https://api.2fa.directory/v3/totp.json"`
+	UsageHistory             bool   `envconfig:"USAGE_HISTORY" default:"true"`
+	UseApikey                bool   `envconfig:"USE_APIKEY" default:"false"`
+	WeakPasswordScore        int    `envconfig:"WEAK_PASSWORD_SCORE" default:"3"`
+	WebUiURL                 string `envconfig:"WEBUI_URL" default:"https://vault.bitwarden.com"`
 }
 
 type BwData struct {
@@ -9,91 +9,386 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"golang.org/x/crypto/nacl/secretbox"
 	"io"
 	"log"
 	"strings"
+	"time"
+
+	"github.com/blacs30/bitwarden-alfred-workflow/alfred"
+	"github.com/deanishe/awgo/keychain"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/nacl/secretbox"
 )
 
-func Encrypt(message []byte) (string, bool) {
-	var nonce [24]byte
-	_, err := io.ReadAtLeast(rand.Reader, nonce[:], 24)
+const (
+	// cacheMagic starts the envelope of the items cache, older versions wrote only "nonce:ciphertext"
+	cacheMagic = "bwcache"
+	// cacheFormatVersion is the version of the envelope
+	cacheFormatVersion = 2
+	// cacheSchemaVersion is increased when the cached items change, e.g. get a new field, so that older caches are rebuilt
+	cacheSchemaVersion = 1
+)
+
+// the key of the items cache is a random one stored in the keychain, or derived from the vault key with CACHE_KEY_FROM_SESSION
+const (
+	cacheKeyKeychain = "keychain"
+	cacheKeySession  = "session"
+)
+
+// The keychain keeps the previous key of the items cache as well. A new key is stored before the cache written
+// with it, so a search in between still opens the previous cache. The key id in its header tells which one it needs.
+const (
+	cacheKeyName         = "encryptPassword"
+	previousCacheKeyName = "encryptPasswordPrevious"
+)
+
+var (
+	errCacheCorrupt  = errors.New("items cache is corrupt")
+	errCacheOutdated = errors.New("items cache is outdated")
+	errCacheLocked   = errors.New("items cache is sealed until Bitwarden is unlocked")
+	// errCacheKeyChanged is a cache sealed with another key of the keychain, it's corrupt if no key fits
+	errCacheKeyChanged = fmt.Errorf("%w: key changed", errCacheCorrupt)
+)
+
+// cacheHeader describes the items cache, it's stored in plain text and authenticated as associated data
+type cacheHeader struct {
+	Format    int       `json:"format"`
+	Schema    int       `json:"schema"`
+	Items     int       `json:"items"`
+	CreatedAt time.Time `json:"createdAt"`
+	Key       string    `json:"key"`
+	// KeyId identifies the key of the keychain, caches of older versions have none
+	KeyId string `json:"keyId,omitempty"`
+}
+
+// Encrypt seals the items cache, message is the JSON array of count items.
+// A new key is created for every write and stored in the keychain, unless it's derived from the vault key.
+func Encrypt(message []byte, count int) error {
+	header := cacheHeader{
+		Format:    cacheFormatVersion,
+		Schema:    cacheSchemaVersion,
+		Items:     count,
+		CreatedAt: time.Now(),
+		Key:       cacheKeySource(),
+	}
+	var password [32]byte
+	var err error
+	if header.Key == cacheKeySession {
+		if password, err = sessionCacheKey(); err != nil {
+			return err
+		}
+	} else if _, err = io.ReadAtLeast(rand.Reader, password[:], 32); err != nil {
+		return err
+	} else {
+		header.KeyId = cacheKeyId(password)
+	}
+	sealed, err := sealCache(password, header, message)
 	if err != nil {
-		log.Println(err)
+		return err
+	}
+	if header.Key == cacheKeySession {
+		// the keys of the keychain mode would still open an older cache
+		for _, name := range []string{cacheKeyName, previousCacheKeyName} {
+			if err := wf.Keychain.Delete(name); err != nil {
+				debugLog(fmt.Sprintf("No cache key %s to delete from the keychain: %s", name, err))
+			}
+		}
+	} else {
+		if current, err := wf.Keychain.Get(cacheKeyName); err == nil {
+			if err := wf.Keychain.Set(previousCacheKeyName, current); err != nil {
+				return err
+			}
+		}
+		if err := wf.Keychain.Set(cacheKeyName, base64.StdEncoding.EncodeToString(password[:])); err != nil {
+			return err
+		}
+	}
+	if wf.Debug() {
+		log.Printf("Encrypted %d items, %d bytes", count, len(sealed))
+	}
+	return wf.Cache.Store(CACHE_NAME, sealed)
+}
+
+// Decrypt opens the items cache. The error wraps errCacheCorrupt or errCacheOutdated if it has to be rebuilt,
+// and errCacheLocked if its key is derived from the vault key and Bitwarden is locked.
+func Decrypt() ([]byte, error) {
+	log.Println("Decrypting data.")
+	sealed, err := wf.Cache.Load(CACHE_NAME)
+	if err != nil {
+		return nil, err
 	}
+	keySource := cacheKeySource()
+	var header cacheHeader
+	var msg []byte
+	if keySource == cacheKeySession {
+		password, err := sessionCacheKey()
+		if err != nil {
+			return nil, err
+		}
+		if header, msg, err = openCache(password, keySource, sealed); err != nil {
+			return nil, err
+		}
+	} else {
+		password, err := keychainCacheKey(cacheKeyName)
+		if err != nil {
+			return nil, err
+		}
+		header, msg, err = openCache(password, keySource, sealed)
+		if errors.Is(err, errCacheKeyChanged) {
+			// the cache of the new key isn't written yet
+			if previous, previousErr := keychainCacheKey(previousCacheKeyName); previousErr == nil {
+				header, msg, err = openCache(previous, keySource, sealed)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	debugLog(fmt.Sprintf("Decrypted %d items cached at %s", header.Items, header.CreatedAt.Format(time.RFC3339)))
+	return msg, nil
+}
+
+// keychainCacheKey reads a key of the items cache from the keychain
+func keychainCacheKey(name string) ([32]byte, error) {
 	var password [32]byte
-	_, err = io.ReadAtLeast(rand.Reader, password[:], 32)
+	passwordBase64, err := wf.Keychain.Get(name)
 	if err != nil {
-		log.Println(err)
+		return password, fmt.Errorf("%w: key not found in the keychain: %s", errCacheCorrupt, err)
 	}
-	encrypted := secretbox.Seal(nil, message, &nonce, &password)
-	base64Enc := base64.StdEncoding.EncodeToString(password[:])
-	err = wf.Keychain.Set("encryptPassword", base64Enc)
+	decoded, err := base64.StdEncoding.DecodeString(passwordBase64)
+	if err != nil || len(decoded) != 32 {
+		return password, fmt.Errorf("%w: invalid key in the keychain", errCacheCorrupt)
+	}
+	copy(password[:], decoded)
+	return password, nil
+}
+
+// cacheKeyId identifies the key without revealing it
+func cacheKeyId(password [32]byte) string {
+	mac := hmac.New(sha256.New, password[:])
+	mac.Write([]byte("bitwarden-alfred-workflow cache key id"))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// sealCache encrypts the message with XChaCha20-Poly1305 into "bwcache:<base64 header>:<nonce hex>:<ciphertext hex>"
+func sealCache(password [32]byte, header cacheHeader, message []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(password[:])
 	if err != nil {
-		log.Println(err)
+		return nil, err
 	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadAtLeast(rand.Reader, nonce, len(nonce)); err != nil {
+		return nil, err
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := aead.Seal(nil, nonce, message, headerJSON)
+	return []byte(fmt.Sprintf("%s:%s:%x:%x", cacheMagic, base64.StdEncoding.EncodeToString(headerJSON), nonce, encrypted)), nil
+}
 
-	if wf.Debug() {
-		log.Printf("%T \n", encrypted)
+// cacheKeySource returns where the key of the items cache comes from
+func cacheKeySource() string {
+	if conf.CacheKeyFromSession {
+		return cacheKeySession
 	}
-	enHex := fmt.Sprintf("%x:%x", nonce[:], encrypted)
-	if wf.Debug() {
-		log.Println("ENCRYPTED:", enHex[0:5])
+	return cacheKeyKeychain
+}
+
+// sessionCacheKey derives the key of the items cache from the vault key, which can only be decrypted with the
+// session of an unlocked vault. Unlike the session it stays the same after locking and unlocking again.
+func sessionCacheKey() ([32]byte, error) {
+	var password [32]byte
+	if bwData.ProtectedKey == "" {
+		return password, errCacheLocked
 	}
-	err = wf.Cache.Store(CACHE_NAME, []byte(enHex))
+	token, err := alfred.GetToken(wf)
+	if err != nil || token == "" {
+		return password, errCacheLocked
+	}
+	userKey, err := MakeDecryptKeyFromSession(bwData.ProtectedKey, token)
 	if err != nil {
-		log.Println(err)
+		return password, fmt.Errorf("couldn't derive the cache key from the session: %w", err)
 	}
-	return enHex, true
+	return deriveCacheKey(userKey), nil
 }
 
-func Decrypt() ([]byte, error) {
-	log.Println("Decrypting data.")
-	encryptedHex, err := wf.Cache.Load(CACHE_NAME)
+// deriveCacheKey derives a key only used for the items cache, so the vault key itself is never used outside Bitwarden
+func deriveCacheKey(userKey CryptoKey) [32]byte {
+	var password [32]byte
+	mac := hmac.New(sha256.New, append(append([]byte{}, userKey.EncKey...), userKey.MacKey...))
+	mac.Write([]byte("bitwarden-alfred-workflow items cache"))
+	copy(password[:], mac.Sum(nil))
+	return password
+}
+
+// openCache decrypts data sealed by sealCache with the key from keySource,
+// and checks that it has the current versions and the expected number of items
+func openCache(password [32]byte, keySource string, data []byte) (cacheHeader, []byte, error) {
+	var header cacheHeader
+	parts := strings.Split(string(data), ":")
+	if len(parts) == 2 {
+		return header, nil, fmt.Errorf("%w: written by an older version", errCacheOutdated)
+	}
+	if len(parts) != 4 || parts[0] != cacheMagic {
+		return header, nil, fmt.Errorf("%w: unknown format", errCacheCorrupt)
+	}
+	headerJSON, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return header, nil, fmt.Errorf("%w: invalid header", errCacheCorrupt)
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return header, nil, fmt.Errorf("%w: invalid header", errCacheCorrupt)
+	}
+	if header.Format != cacheFormatVersion || header.Schema != cacheSchemaVersion {
+		return header, nil, fmt.Errorf("%w: format %d schema %d, expected format %d schema %d",
+			errCacheOutdated, header.Format, header.Schema, cacheFormatVersion, cacheSchemaVersion)
+	}
+	if header.Key != keySource {
+		return header, nil, fmt.Errorf("%w: sealed with the %s key instead of the %s key", errCacheOutdated, header.Key, keySource)
+	}
+	if header.KeyId != "" && header.KeyId != cacheKeyId(password) {
+		return header, nil, fmt.Errorf("%w: sealed with another key", errCacheKeyChanged)
+	}
+	nonce, err := hex.DecodeString(parts[2])
+	if err != nil || len(nonce) != chacha20poly1305.NonceSizeX {
+		return header, nil, fmt.Errorf("%w: invalid nonce", errCacheCorrupt)
+	}
+	encrypted, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return header, nil, fmt.Errorf("%w: invalid message", errCacheCorrupt)
+	}
+	aead, err := chacha20poly1305.NewX(password[:])
+	if err != nil {
+		return header, nil, err
+	}
+	msg, err := aead.Open(nil, nonce, encrypted, headerJSON)
+	if err != nil {
+		return header, nil, fmt.Errorf("%w: failed to decrypt, wrong key or modified data", errCacheCorrupt)
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(msg, &items); err != nil {
+		return header, nil, fmt.Errorf("%w: %s", errCacheCorrupt, err)
+	}
+	if len(items) != header.Items {
+		return header, nil, fmt.Errorf("%w: %d items instead of %d", errCacheCorrupt, len(items), header.Items)
+	}
+	return header, msg, nil
+}
+
+// encryptWithKey seals the message with the key stored in the keychain under keyName,
+// unlike Encrypt the key is created once and kept, so that the data can be updated.
+func encryptWithKey(keyName string, message []byte) ([]byte, error) {
+	password, err := getOrCreateKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	return sealWithKey(password, message)
+}
+
+// decryptWithKey opens data sealed by encryptWithKey
+func decryptWithKey(keyName string, data []byte) ([]byte, error) {
+	password, err := getOrCreateKey(keyName)
 	if err != nil {
-		log.Println(err)
 		return nil, err
 	}
-	var nonce2 [24]byte
-	parts := strings.SplitN(string(encryptedHex), ":", 2)
+	return openWithKey(password, data)
+}
+
+// encryptMetadata seals data cached next to the items, like the items cache it can't be read while Bitwarden
+// is locked with CACHE_KEY_FROM_SESSION. Otherwise the key keyName of the keychain is used.
+func encryptMetadata(keyName string, message []byte) ([]byte, error) {
+	password, err := metadataKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	return sealWithKey(password, message)
+}
+
+// decryptMetadata opens data sealed by encryptMetadata
+func decryptMetadata(keyName string, data []byte) ([]byte, error) {
+	password, err := metadataKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	return openWithKey(password, data)
+}
+
+func metadataKey(keyName string) ([32]byte, error) {
+	if cacheKeySource() != cacheKeySession {
+		return getOrCreateKey(keyName)
+	}
+	password, err := sessionCacheKey()
+	if err != nil {
+		return password, err
+	}
+	// every kind of data gets its own key
+	mac := hmac.New(sha256.New, password[:])
+	mac.Write([]byte(keyName))
+	copy(password[:], mac.Sum(nil))
+	return password, nil
+}
+
+// sealWithKey encrypts the message with secretbox into "<nonce hex>:<ciphertext hex>"
+func sealWithKey(password [32]byte, message []byte) ([]byte, error) {
+	var nonce [24]byte
+	if _, err := io.ReadAtLeast(rand.Reader, nonce[:], 24); err != nil {
+		return nil, err
+	}
+	encrypted := secretbox.Seal(nil, message, &nonce, &password)
+	return []byte(fmt.Sprintf("%x:%x", nonce[:], encrypted)), nil
+}
+
+// openWithKey decrypts data sealed by sealWithKey
+func openWithKey(password [32]byte, data []byte) ([]byte, error) {
+	parts := strings.SplitN(string(data), ":", 2)
 	if len(parts) < 2 {
-		log.Println("expected nonce")
 		return nil, errors.New("expected nonce")
 	}
-	//get nonce
+	var nonce [24]byte
 	bs, err := hex.DecodeString(parts[0])
 	if err != nil || len(bs) != 24 {
-		log.Println("invalid nonce")
-		return nil, errors.New("Invalid nonce")
+		return nil, errors.New("invalid nonce")
 	}
-	copy(nonce2[:], bs)
-	// get message
+	copy(nonce[:], bs)
 	bs, err = hex.DecodeString(parts[1])
 	if err != nil {
-		log.Println("invalid message")
-		return nil, errors.New("Invalid message")
-	}
-	passwordBase64, err := wf.Keychain.Get("encryptPassword")
-	if err != nil {
-		log.Println(err)
+		return nil, errors.New("invalid message")
 	}
-	decoded64, err := base64.StdEncoding.DecodeString(passwordBase64)
-	if err != nil {
-		log.Println(err)
-	}
-	var password [32]byte
-	copy(password[:], decoded64)
-
-	// you need the password to open the sealed secret box
-	msg, ok := secretbox.Open(nil, bs, &nonce2, &password)
+	msg, ok := secretbox.Open(nil, bs, &nonce, &password)
 	if !ok {
-		log.Print("invalid message")
+		return nil, errors.New("failed to decrypt, wrong key or corrupt data")
 	}
 	return msg, nil
 }
 
+// getOrCreateKey returns the key keyName of the keychain, a new one is only created if it doesn't exist yet.
+// Other errors, e.g. a denied keychain access, are returned so that the data sealed with the key isn't lost.
+func getOrCreateKey(keyName string) ([32]byte, error) {
+	var password [32]byte
+	passwordBase64, err := wf.Keychain.Get(keyName)
+	if err == nil {
+		decoded, err := base64.StdEncoding.DecodeString(passwordBase64)
+		if err != nil || len(decoded) != 32 {
+			return password, fmt.Errorf("invalid key %s in the keychain", keyName)
+		}
+		copy(password[:], decoded)
+		return password, nil
+	}
+	if !errors.Is(err, keychain.ErrNotFound) {
+		return password, err
+	}
+	if _, err := io.ReadAtLeast(rand.Reader, password[:], 32); err != nil {
+		return password, err
+	}
+	err = wf.Keychain.Set(keyName, base64.StdEncoding.EncodeToString(password[:]))
+	return password, err
+}
+
 // These notes helped a lot https://github.com/attie/bitwarden-decrypt
 // as well as this repo https://github.com/mvdan/bitw
 // and https://github.com/philhug/bitwarden-client-go
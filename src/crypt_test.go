@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_openCache(t *testing.T) {
+	var password, otherPassword [32]byte
+	copy(password[:], "0123456789abcdef0123456789abcdef")
+	copy(otherPassword[:], "fedcba9876543210fedcba9876543210")
+	message := []byte(`[{"id":"a"},{"id":"b"}]`)
+	header := cacheHeader{Format: cacheFormatVersion, Schema: cacheSchemaVersion, Items: 2, CreatedAt: time.Now().UTC(), Key: cacheKeyKeychain, KeyId: cacheKeyId(password)}
+	withoutKeyId := header
+	withoutKeyId.KeyId = ""
+
+	seal := func(h cacheHeader) string {
+		sealed, err := sealCache(password, h, message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(sealed)
+	}
+	// replaceHeader swaps the plain text header without sealing again
+	replaceHeader := func(sealed string, h cacheHeader) string {
+		parts := strings.Split(sealed, ":")
+		headerJSON, _ := json.Marshal(h)
+		parts[1] = base64.StdEncoding.EncodeToString(headerJSON)
+		return strings.Join(parts, ":")
+	}
+	valid := seal(header)
+
+	tests := []struct {
+		name     string
+		password [32]byte
+		data     string
+		wantErr  error
+	}{
+		{name: "valid", password: password, data: valid},
+		{name: "old format", password: password, data: "6e6f6e6365:636970686572", wantErr: errCacheOutdated},
+		{name: "old schema", password: password, data: seal(cacheHeader{Format: cacheFormatVersion, Schema: cacheSchemaVersion - 1, Items: 2, Key: cacheKeyKeychain}), wantErr: errCacheOutdated},
+		{name: "other key source", password: password, data: seal(cacheHeader{Format: cacheFormatVersion, Schema: cacheSchemaVersion, Items: 2, Key: cacheKeySession}), wantErr: errCacheOutdated},
+		{name: "garbage", password: password, data: "not a cache", wantErr: errCacheCorrupt},
+		{name: "wrong key", password: otherPassword, data: valid, wantErr: errCacheCorrupt},
+		{name: "key changed", password: otherPassword, data: valid, wantErr: errCacheKeyChanged},
+		{name: "older cache without key id", password: password, data: seal(withoutKeyId)},
+		{name: "modified header", password: password, data: replaceHeader(valid, cacheHeader{Format: cacheFormatVersion, Schema: cacheSchemaVersion, Items: 1, CreatedAt: header.CreatedAt, Key: cacheKeyKeychain}), wantErr: errCacheCorrupt},
+		{name: "modified ciphertext", password: password, data: valid[:len(valid)-2] + fmt.Sprintf("%02x", 0xff^valid[len(valid)-1]), wantErr: errCacheCorrupt},
+		{name: "wrong item count", password: password, data: seal(cacheHeader{Format: cacheFormatVersion, Schema: cacheSchemaVersion, Items: 3, Key: cacheKeyKeychain}), wantErr: errCacheCorrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotHeader, got, err := openCache(tt.password, cacheKeyKeychain, []byte(tt.data))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("openCache() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("openCache() error = %v", err)
+			}
+			if !bytes.Equal(got, message) || gotHeader.Items != 2 || !gotHeader.CreatedAt.Equal(header.CreatedAt) {
+				t.Errorf("openCache() = %+v %s, want %+v %s", gotHeader, got, header, message)
+			}
+		})
+	}
+}
+
+func Test_deriveCacheKey(t *testing.T) {
+	userKey := CryptoKey{EncKey: bytes.Repeat([]byte{1}, 32), MacKey: bytes.Repeat([]byte{2}, 32), EncryptionType: 2}
+	otherKey := CryptoKey{EncKey: bytes.Repeat([]byte{1}, 32), MacKey: bytes.Repeat([]byte{3}, 32), EncryptionType: 2}
+	key := deriveCacheKey(userKey)
+	if key != deriveCacheKey(userKey) {
+		t.Error("deriveCacheKey() isn't deterministic")
+	}
+	if key == deriveCacheKey(otherKey) {
+		t.Error("deriveCacheKey() returned the same key for different vault keys")
+	}
+	if bytes.Equal(key[:], userKey.EncKey) {
+		t.Error("deriveCacheKey() returned the vault key")
+	}
+}
@@ -0,0 +1,489 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/blacs30/bitwarden-alfred-workflow/alfred"
+	ps "github.com/mitchellh/go-ps"
+)
+
+const (
+	// daemonLabel is the label of the LaunchAgent running the daemon
+	daemonLabel = "com.lisowski-development.alfred.bitwarden.daemon"
+	// daemonTick is how often the daemon checks whether to lock or sync
+	daemonTick = time.Minute
+	// daemonLogName is the file in the cache directory the LaunchAgent writes the log of the daemon to
+	daemonLogName = "daemon.log"
+)
+
+// clockTime is a time of the day of AUTOSYNC_TIMES
+type clockTime struct {
+	Hour   int
+	Minute int
+}
+
+// syncSchedule is AUTOSYNC_TIMES, either the seconds between two syncs or times of the day like "8:15,23:45"
+type syncSchedule struct {
+	Interval time.Duration
+	Times    []clockTime
+}
+
+func parseSyncSchedule(value string) (syncSchedule, error) {
+	var schedule syncSchedule
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return schedule, nil
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return schedule, fmt.Errorf("invalid AUTOSYNC_TIMES %q, the interval must be positive", value)
+		}
+		schedule.Interval = time.Duration(seconds) * time.Second
+		return schedule, nil
+	}
+	for _, entry := range splitList(value) {
+		hour, minute, ok := strings.Cut(entry, ":")
+		h, errHour := strconv.Atoi(hour)
+		m, errMinute := strconv.Atoi(minute)
+		if !ok || errHour != nil || errMinute != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+			return schedule, fmt.Errorf("invalid AUTOSYNC_TIMES %q, expected times like 8:15", entry)
+		}
+		schedule.Times = append(schedule.Times, clockTime{Hour: h, Minute: m})
+	}
+	return schedule, nil
+}
+
+// next returns the first sync after the time, false if no sync is scheduled
+func (s syncSchedule) next(after time.Time) (time.Time, bool) {
+	if s.Interval > 0 {
+		return after.Add(s.Interval), true
+	}
+	var next time.Time
+	for _, t := range s.Times {
+		candidate := time.Date(after.Year(), after.Month(), after.Day(), t.Hour, t.Minute, 0, 0, after.Location())
+		if !candidate.After(after) {
+			candidate = candidate.AddDate(0, 0, 1)
+		}
+		if next.IsZero() || candidate.Before(next) {
+			next = candidate
+		}
+	}
+	return next, !next.IsZero()
+}
+
+func (s syncSchedule) String() string {
+	if s.Interval > 0 {
+		return fmt.Sprintf("every %s", s.Interval)
+	}
+	if len(s.Times) == 0 {
+		return "disabled"
+	}
+	var times []string
+	for _, t := range s.Times {
+		times = append(times, fmt.Sprintf("%d:%02d", t.Hour, t.Minute))
+	}
+	return fmt.Sprintf("at %s", strings.Join(times, ", "))
+}
+
+// daemonScheduler decides when the daemon locks and syncs, the clock is injected for the tests
+type daemonScheduler struct {
+	// lockAfter is the time without a search after which the vault is locked, 0 disables it
+	lockAfter time.Duration
+	schedule  syncSchedule
+	// jitter is the maximum random delay of a sync, so that not every Mac syncs at the same minute
+	jitter time.Duration
+	now    func() time.Time
+	random func(max time.Duration) time.Duration
+
+	nextSync     time.Time
+	checkedStart bool
+}
+
+func newDaemonScheduler(lockAfter time.Duration, schedule syncSchedule, jitter time.Duration, now func() time.Time, random func(time.Duration) time.Duration) *daemonScheduler {
+	s := &daemonScheduler{lockAfter: lockAfter, schedule: schedule, jitter: jitter, now: now, random: random}
+	s.planSync()
+	return s
+}
+
+// planSync sets the next sync after now, delayed by up to jitter
+func (s *daemonScheduler) planSync() {
+	next, ok := s.schedule.next(s.now())
+	if !ok {
+		s.nextSync = time.Time{}
+		return
+	}
+	if s.jitter > 0 {
+		next = next.Add(s.random(s.jitter))
+	}
+	s.nextSync = next
+}
+
+// shouldLock reports whether the unlocked vault has to be locked: after lockAfter without a search,
+// and on the first check if it wasn't used since the system started. A zero lastUsage is unknown,
+// e.g. before the first search, and never locks.
+func (s *daemonScheduler) shouldLock(lastUsage, bootTime time.Time) bool {
+	firstCheck := !s.checkedStart
+	s.checkedStart = true
+	if lastUsage.IsZero() {
+		return false
+	}
+	if firstCheck && !bootTime.IsZero() && lastUsage.Before(bootTime) {
+		return true
+	}
+	return s.lockAfter > 0 && s.now().Sub(lastUsage) > s.lockAfter
+}
+
+// syncDue reports whether the planned sync is due and plans the next one,
+// syncs missed while the Mac was asleep result in a single sync.
+func (s *daemonScheduler) syncDue() bool {
+	if s.nextSync.IsZero() || s.now().Before(s.nextSync) {
+		return false
+	}
+	s.planSync()
+	return true
+}
+
+// daemonStatus is written by the daemon on every check and shown in the settings
+type daemonStatus struct {
+	Pid       int       `json:"pid"`
+	Started   time.Time `json:"started"`
+	LastCheck time.Time `json:"lastCheck"`
+	LastLock  time.Time `json:"lastLock"`
+	LastSync  time.Time `json:"lastSync"`
+	NextSync  time.Time `json:"nextSync"`
+	LockAfter int       `json:"lockAfter"`
+	Schedule  string    `json:"schedule"`
+	// ScheduleError is an invalid AUTOSYNC_TIMES, it stays until the daemon is restarted
+	ScheduleError string `json:"scheduleError,omitempty"`
+	// Error is the error of the last lock or sync, it's cleared by the next successful one
+	Error string `json:"error"`
+}
+
+// running reports whether the daemon of the status is still checking
+func (s daemonStatus) running(now time.Time) bool {
+	return s.Pid > 0 && now.Sub(s.LastCheck) < 3*daemonTick
+}
+
+func loadDaemonStatus() (daemonStatus, error) {
+	var status daemonStatus
+	if !wf.Cache.Exists(DAEMON_STATUS_NAME) {
+		return status, nil
+	}
+	err := wf.Cache.LoadJSON(DAEMON_STATUS_NAME, &status)
+	return status, err
+}
+
+// runningDaemonPid returns the pid of the running daemon or 0, it mustn't be killed as stale process
+func runningDaemonPid() int {
+	status, err := loadDaemonStatus()
+	if err != nil || !status.running(time.Now()) {
+		return 0
+	}
+	if process, err := ps.FindProcess(status.Pid); err != nil || process == nil {
+		return 0
+	}
+	return status.Pid
+}
+
+// autosyncTimes returns AUTOSYNC_TIMES, or AUTO_HOUR and AUTO_MIN as a single time
+func autosyncTimes() string {
+	if conf.AutosyncTimes != "" || conf.AutoHour == "" {
+		return conf.AutosyncTimes
+	}
+	minute := conf.AutoMin
+	if minute == "" {
+		minute = "0"
+	}
+	return fmt.Sprintf("%s:%s", conf.AutoHour, minute)
+}
+
+// runDaemon locks the vault after LOCK_TIMEOUT minutes without a search and syncs at AUTOSYNC_TIMES,
+// it's started by the LaunchAgent installed with -installdaemon
+func runDaemon() {
+	// the settings changed since the installation are used, the jobs started by the daemon inherit them
+	if err := loadWorkflowVariables(filepath.Join(wf.Dir(), "info.plist")); err != nil {
+		log.Printf("Couldn't read the workflow variables, using the ones of the installation, error: %s", err)
+	} else {
+		loadConfig()
+	}
+	// the syncs started by the daemon don't open the search
+	if err := os.Setenv("BACKGROUND_SYNC_DAEMON", "true"); err != nil {
+		log.Println(err)
+	}
+	status := daemonStatus{
+		Pid:       os.Getpid(),
+		Started:   time.Now(),
+		LockAfter: conf.LockTimeout,
+	}
+	schedule, err := parseSyncSchedule(autosyncTimes())
+	if err != nil {
+		log.Println(err)
+		status.ScheduleError = err.Error()
+	} else if len(schedule.Times) > 0 || schedule.Interval > 0 {
+		status.Schedule = schedule.String()
+	}
+	random := func(max time.Duration) time.Duration {
+		return time.Duration(rand.Int63n(int64(max)))
+	}
+	rand.Seed(time.Now().UnixNano())
+	scheduler := newDaemonScheduler(time.Duration(conf.LockTimeout)*time.Minute, schedule,
+		time.Duration(conf.AutosyncJitter)*time.Minute, time.Now, random)
+	boot := bootTime()
+	log.Printf("Daemon started, lock after %d minutes, sync %s", conf.LockTimeout, status.Schedule)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	ticker := time.NewTicker(daemonTick)
+	defer ticker.Stop()
+	for {
+		daemonCheck(scheduler, &status, boot)
+		if err := wf.Cache.StoreJSON(DAEMON_STATUS_NAME, status); err != nil {
+			log.Println(err)
+		}
+		select {
+		case <-ticker.C:
+		case sig := <-stop:
+			log.Printf("Daemon stopped by %s", sig)
+			status.Pid = 0
+			if err := wf.Cache.StoreJSON(DAEMON_STATUS_NAME, status); err != nil {
+				log.Println(err)
+			}
+			return
+		}
+	}
+}
+
+// daemonCheck locks or syncs if it's due
+func daemonCheck(scheduler *daemonScheduler, status *daemonStatus, boot time.Time) {
+	now := scheduler.now()
+	status.LastCheck = now
+
+	// the vault may have been unlocked or locked since the last check
+	bwData = BwData{}
+	if err := loadBitwardenJSON(); err != nil {
+		log.Println(err)
+	}
+	_, tokenErr := alfred.GetToken(wf)
+	unlocked := bwData.ProtectedKey != "" || tokenErr == nil
+
+	if unlocked && scheduler.shouldLock(lastUsage(), boot) {
+		log.Println("Daemon is locking Bitwarden.")
+		if err := runDaemonJob("-lock"); err != nil {
+			log.Println(err)
+			status.Error = err.Error()
+		} else {
+			status.LastLock = now
+			status.Error = ""
+			unlocked = false
+		}
+	}
+	if scheduler.syncDue() {
+		if !unlocked {
+			log.Println("Daemon skips the sync, Bitwarden is locked.")
+		} else if err := startBackgroundSync(true); err != nil {
+			log.Println(err)
+			status.Error = err.Error()
+		} else {
+			status.LastSync = now
+			status.Error = ""
+		}
+	}
+	status.NextSync = scheduler.nextSync
+}
+
+// lastUsage is the time of the last search, LAST_USAGE_CACHE, or zero if it's unknown
+func lastUsage() time.Time {
+	if !wf.Cache.Exists(LAST_USAGE_CACHE) {
+		return time.Time{}
+	}
+	data, err := wf.Cache.Load(LAST_USAGE_CACHE)
+	if err != nil {
+		log.Println(err)
+		return time.Time{}
+	}
+	timestamp, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		log.Println(err)
+		return time.Time{}
+	}
+	return time.Unix(timestamp, 0)
+}
+
+// runDaemonJob runs the workflow with the arguments and waits for it
+func runDaemonJob(args ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, os.Args[0], args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// launchAgentPlist returns the LaunchAgent running the daemon with the variables of Alfred,
+// launchd restarts it if it crashes
+func launchAgentPlist(label, executable, workDir, logPath string, env map[string]string) []byte {
+	escape := func(s string) string {
+		var b bytes.Buffer
+		_ = xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>` + escape(label) + `</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>` + escape(executable) + `</string>
+		<string>-daemon</string>
+	</array>
+	<key>WorkingDirectory</key>
+	<string>` + escape(workDir) + `</string>
+	<key>EnvironmentVariables</key>
+	<dict>
+`)
+	for _, key := range keys {
+		b.WriteString("\t\t<key>" + escape(key) + "</key>\n\t\t<string>" + escape(env[key]) + "</string>\n")
+	}
+	b.WriteString(`	</dict>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>StandardErrorPath</key>
+	<string>` + escape(logPath) + `</string>
+</dict>
+</plist>
+`)
+	return []byte(b.String())
+}
+
+// daemonEnvironment are the variables of Alfred locating the workflow and PATH to find bw,
+// the workflow variables are read from info.plist when the daemon starts
+func daemonEnvironment() map[string]string {
+	env := map[string]string{}
+	for _, entry := range os.Environ() {
+		key, value, ok := strings.Cut(entry, "=")
+		if ok && (strings.HasPrefix(key, "alfred_") || key == "PATH") {
+			env[key] = value
+		}
+	}
+	return env
+}
+
+// plistNode is an element of a property list with its children
+type plistNode struct {
+	XMLName  xml.Name
+	Content  string      `xml:",chardata"`
+	Children []plistNode `xml:",any"`
+}
+
+// workflowVariables returns the workflow variables of info.plist, Alfred stores the values set by the user there
+func workflowVariables(data []byte) (map[string]string, error) {
+	var plist struct {
+		Dict plistNode `xml:"dict"`
+	}
+	if err := xml.Unmarshal(data, &plist); err != nil {
+		return nil, err
+	}
+	entries := plist.Dict.Children
+	for i := 0; i+1 < len(entries); i += 2 {
+		if entries[i].XMLName.Local != "key" || entries[i].Content != "variables" {
+			continue
+		}
+		variables := map[string]string{}
+		values := entries[i+1].Children
+		for j := 0; j+1 < len(values); j += 2 {
+			variables[values[j].Content] = values[j+1].Content
+		}
+		return variables, nil
+	}
+	return nil, fmt.Errorf("no workflow variables found")
+}
+
+// loadWorkflowVariables sets the workflow variables of the info.plist at path as environment
+func loadWorkflowVariables(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	variables, err := workflowVariables(data)
+	if err != nil {
+		return err
+	}
+	for key, value := range variables {
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runInstallDaemon installs the LaunchAgent of the daemon, the result line is shown as notification
+func runInstallDaemon() {
+	schedule, err := parseSyncSchedule(autosyncTimes())
+	if err != nil {
+		fmt.Printf("result|1|%s\n", err)
+		return
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		fmt.Printf("result|1|%s\n", err)
+		return
+	}
+	logPath := filepath.Join(wf.CacheDir(), daemonLogName)
+	plist := launchAgentPlist(daemonLabel, executable, wf.Dir(), logPath, daemonEnvironment())
+	if err := installLaunchAgent(daemonLabel, plist); err != nil {
+		fmt.Printf("result|1|Could not install the daemon: %s\n", err)
+		return
+	}
+	message := "Daemon installed"
+	if conf.LockTimeout > 0 {
+		message += fmt.Sprintf(", it locks after %d minutes without use", conf.LockTimeout)
+	}
+	if len(schedule.Times) > 0 || schedule.Interval > 0 {
+		message += fmt.Sprintf(", it syncs %s", schedule)
+	}
+	fmt.Printf("result|0|%s\n", message)
+}
+
+// runUninstallDaemon removes the LaunchAgent of the daemon and those of the shell scripts of older versions
+func runUninstallDaemon() {
+	if err := uninstallLaunchAgent(daemonLabel); err != nil {
+		fmt.Printf("result|1|Could not remove the daemon: %s\n", err)
+		return
+	}
+	if err := wf.Cache.StoreJSON(DAEMON_STATUS_NAME, nil); err != nil {
+		log.Println(err)
+	}
+	fmt.Println("result|0|Daemon has been removed")
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// the LaunchAgents of bw_auto_lock.sh and bw_cache_update.sh of older versions
+var legacyLaunchAgents = []string{
+	"bw_auto_lock.sh_lock_agent",
+	"com.lisowski-development.alfred.bitwarden_autosync",
+}
+
+func launchAgentPath(label string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", label+".plist"), nil
+}
+
+// installLaunchAgent replaces the LaunchAgent with the label and loads it
+func installLaunchAgent(label string, plist []byte) error {
+	if err := uninstallLaunchAgent(label); err != nil {
+		return err
+	}
+	path, err := launchAgentPath(label)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// the LaunchAgent is only readable by the user
+	if err := os.WriteFile(path, plist, 0600); err != nil {
+		return err
+	}
+	output, err := exec.Command("/bin/launchctl", "bootstrap", fmt.Sprintf("gui/%d", os.Getuid()), path).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("launchctl bootstrap: %w: %s", err, output)
+	}
+	return nil
+}
+
+// uninstallLaunchAgent unloads and deletes the LaunchAgent with the label and the ones of the older versions
+func uninstallLaunchAgent(label string) error {
+	for _, l := range append([]string{label}, legacyLaunchAgents...) {
+		path, err := launchAgentPath(l)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		// fails if it isn't loaded, it's deleted either way
+		if output, err := exec.Command("/bin/launchctl", "bootout", fmt.Sprintf("gui/%d", os.Getuid()), path).CombinedOutput(); err != nil {
+			log.Printf("launchctl bootout %s: %s %s", l, err, output)
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bootTime is the time the Mac started
+func bootTime() time.Time {
+	tv, err := unix.SysctlTimeval("kern.boottime")
+	if err != nil {
+		log.Println(err)
+		return time.Time{}
+	}
+	return time.Unix(tv.Unix())
+}
@@ -0,0 +1,26 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+//go:build !darwin
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+var errDaemonUnsupported = errors.New("the daemon is installed as LaunchAgent and only available on macOS")
+
+func installLaunchAgent(label string, plist []byte) error {
+	return errDaemonUnsupported
+}
+
+func uninstallLaunchAgent(label string) error {
+	return errDaemonUnsupported
+}
+
+// bootTime is unknown, the daemon only locks after LOCK_TIMEOUT
+func bootTime() time.Time {
+	return time.Time{}
+}
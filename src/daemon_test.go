@@ -0,0 +1,191 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_parseSyncSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "disabled", value: "", want: "disabled"},
+		{name: "interval in seconds", value: "3600", want: "every 1h0m0s"},
+		{name: "times", value: "8:15, 23:45", want: "at 8:15, 23:45"},
+		{name: "zero interval", value: "0", wantErr: true},
+		{name: "invalid hour", value: "24:00", wantErr: true},
+		{name: "short interval", value: "8", want: "every 8s"},
+		{name: "not a time", value: "8:15,noon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSyncSchedule(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSyncSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("parseSyncSchedule() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_syncSchedule_next(t *testing.T) {
+	times, _ := parseSyncSchedule("8:15,23:45")
+	tests := []struct {
+		name     string
+		schedule syncSchedule
+		after    time.Time
+		want     time.Time
+		wantOk   bool
+	}{
+		{name: "later today", schedule: times, after: time.Date(2022, 5, 1, 9, 0, 0, 0, time.UTC), want: time.Date(2022, 5, 1, 23, 45, 0, 0, time.UTC), wantOk: true},
+		{name: "tomorrow", schedule: times, after: time.Date(2022, 5, 1, 23, 45, 0, 0, time.UTC), want: time.Date(2022, 5, 2, 8, 15, 0, 0, time.UTC), wantOk: true},
+		{name: "earliest", schedule: times, after: time.Date(2022, 5, 1, 6, 0, 0, 0, time.UTC), want: time.Date(2022, 5, 1, 8, 15, 0, 0, time.UTC), wantOk: true},
+		{name: "interval", schedule: syncSchedule{Interval: time.Hour}, after: time.Date(2022, 5, 1, 6, 10, 0, 0, time.UTC), want: time.Date(2022, 5, 1, 7, 10, 0, 0, time.UTC), wantOk: true},
+		{name: "disabled", after: time.Date(2022, 5, 1, 6, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.schedule.next(tt.after)
+			if ok != tt.wantOk || !got.Equal(tt.want) {
+				t.Errorf("next() = %s, %v, want %s, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_daemonScheduler(t *testing.T) {
+	now := time.Date(2022, 5, 1, 8, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	jitter := func(max time.Duration) time.Duration { return max / 2 }
+	schedule, _ := parseSyncSchedule("8:15")
+	s := newDaemonScheduler(30*time.Minute, schedule, 10*time.Minute, clock, jitter)
+
+	if want := time.Date(2022, 5, 1, 8, 20, 0, 0, time.UTC); !s.nextSync.Equal(want) {
+		t.Fatalf("nextSync = %s, want %s", s.nextSync, want)
+	}
+
+	boot := now.Add(-time.Hour)
+	unknown := newDaemonScheduler(30*time.Minute, schedule, 0, clock, jitter)
+	if unknown.shouldLock(time.Time{}, boot) {
+		t.Error("shouldLock() = true without a known last usage")
+	}
+	if !s.shouldLock(boot.Add(-time.Minute), boot) {
+		t.Error("shouldLock() = false on the first check without use since the boot")
+	}
+	if s.shouldLock(now.Add(-10*time.Minute), boot) {
+		t.Error("shouldLock() = true within the lock timeout")
+	}
+	if s.shouldLock(boot.Add(-time.Minute).Add(40*time.Minute), boot) {
+		t.Error("shouldLock() = true for the boot after the first check")
+	}
+	if !s.shouldLock(now.Add(-31*time.Minute), boot) {
+		t.Error("shouldLock() = false after the lock timeout")
+	}
+
+	if s.syncDue() {
+		t.Error("syncDue() = true before the planned sync")
+	}
+	// the Mac slept through two syncs
+	now = time.Date(2022, 5, 3, 9, 0, 0, 0, time.UTC)
+	if !s.syncDue() {
+		t.Error("syncDue() = false after the planned sync")
+	}
+	if s.syncDue() {
+		t.Error("syncDue() = true twice for missed syncs")
+	}
+	if want := time.Date(2022, 5, 4, 8, 20, 0, 0, time.UTC); !s.nextSync.Equal(want) {
+		t.Errorf("nextSync = %s, want %s", s.nextSync, want)
+	}
+
+	disabled := newDaemonScheduler(0, syncSchedule{}, 0, clock, jitter)
+	if disabled.syncDue() || disabled.shouldLock(time.Time{}, time.Time{}) {
+		t.Error("disabled scheduler locks or syncs")
+	}
+}
+
+func Test_launchAgentPlist(t *testing.T) {
+	plist := string(launchAgentPlist("label", "/Alfred/workflow/bitwarden-alfred-workflow", "/Alfred/workflow", "/Alfred/cache/daemon.log",
+		map[string]string{"PATH": "/usr/local/bin:/usr/bin", "alfred_workflow_bundleid": "com.example", "SKIP": "a<b&c"}))
+	for _, want := range []string{
+		"<string>/Alfred/workflow/bitwarden-alfred-workflow</string>\n\t\t<string>-daemon</string>",
+		"<key>PATH</key>\n\t\t<string>/usr/local/bin:/usr/bin</string>",
+		"<string>a&lt;b&amp;c</string>",
+		"<key>WorkingDirectory</key>\n\t<string>/Alfred/workflow</string>",
+		"<key>StandardErrorPath</key>\n\t<string>/Alfred/cache/daemon.log</string>",
+	} {
+		if !strings.Contains(plist, want) {
+			t.Errorf("launchAgentPlist() doesn't contain %q:\n%s", want, plist)
+		}
+	}
+	if strings.Index(plist, "<key>PATH</key>") > strings.Index(plist, "<key>alfred_workflow_bundleid</key>") {
+		t.Error("launchAgentPlist() doesn't sort the environment")
+	}
+}
+
+func Test_daemonEnvironment(t *testing.T) {
+	t.Setenv("alfred_workflow_data", "/Alfred/data")
+	t.Setenv("EMAIL", "alice@example.com")
+	t.Setenv("BW_SESSION", "secret")
+	env := daemonEnvironment()
+	if env["alfred_workflow_data"] != "/Alfred/data" || env["PATH"] != os.Getenv("PATH") {
+		t.Errorf("daemonEnvironment() = %v, want the variables of Alfred and PATH", env)
+	}
+	for _, key := range []string{"EMAIL", "BW_SESSION"} {
+		if _, ok := env[key]; ok {
+			t.Errorf("daemonEnvironment() contains %s", key)
+		}
+	}
+}
+
+func Test_workflowVariables(t *testing.T) {
+	data := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>bundleid</key>
+	<string>com.example</string>
+	<key>objects</key>
+	<array>
+		<dict>
+			<key>variables</key>
+			<dict>
+				<key>LOCK_TIMEOUT</key>
+				<string>0</string>
+			</dict>
+		</dict>
+	</array>
+	<key>variables</key>
+	<dict>
+		<key>AUTOSYNC_TIMES</key>
+		<string>8:15,23:45</string>
+		<key>EMAIL</key>
+		<string></string>
+		<key>LOCK_TIMEOUT</key>
+		<string>30</string>
+	</dict>
+	<key>version</key>
+	<string>2.4.7</string>
+</dict>
+</plist>
+`)
+	got, err := workflowVariables(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"AUTOSYNC_TIMES": "8:15,23:45", "EMAIL": "", "LOCK_TIMEOUT": "30"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("workflowVariables() = %v, want %v", got, want)
+	}
+
+	if _, err := workflowVariables([]byte(`<plist version="1.0"><dict><key>name</key><string>Bitwarden</string></dict></plist>`)); err == nil {
+		t.Error("workflowVariables() without variables, want an error")
+	}
+}
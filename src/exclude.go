@@ -0,0 +1,113 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// exclusionRule is a kind of exclusion rules, named like the qualifier of the search it uses
+type exclusionRule struct {
+	Name  string
+	Title string
+}
+
+// the kinds of rules in the order they are applied and shown
+var exclusionRuleKinds = []exclusionRule{
+	{Name: "type", Title: "type"},
+	{Name: "folder", Title: "folder"},
+	{Name: "org", Title: "organization"},
+	{Name: "collection", Title: "collection"},
+	{Name: "name", Title: "name"},
+}
+
+// exclusionRules decide which items aren't cached, excluded items can't be found by any search.
+// Folders, organizations and collections match by name or id like the qualifiers of the search,
+// a folder excludes its subfolders too.
+type exclusionRules struct {
+	Types         []string
+	Folders       []string
+	Organizations []string
+	Collections   []string
+	Name          *regexp.Regexp
+}
+
+// newExclusionRules reads the rules of SKIP_TYPES and the EXCLUDE_* variables
+func newExclusionRules() (exclusionRules, error) {
+	rules := exclusionRules{
+		Types:         splitList(conf.SkipTypes),
+		Folders:       splitList(conf.ExcludeFolders),
+		Organizations: splitList(conf.ExcludeOrganizations),
+		Collections:   splitList(conf.ExcludeCollections),
+	}
+	if conf.ExcludeNameRegex != "" {
+		re, err := regexp.Compile(conf.ExcludeNameRegex)
+		if err != nil {
+			return rules, fmt.Errorf("invalid EXCLUDE_NAME_REGEX: %w", err)
+		}
+		rules.Name = re
+	}
+	return rules, nil
+}
+
+// excludes returns the name of the first rule which excludes the item
+func (r exclusionRules) excludes(item Item, ctx searchContext) (string, bool) {
+	values := map[string][]string{
+		"type":       r.Types,
+		"folder":     r.Folders,
+		"org":        r.Organizations,
+		"collection": r.Collections,
+	}
+	for _, rule := range exclusionRuleKinds {
+		if rule.Name == "name" && r.Name != nil && r.Name.MatchString(item.Name) {
+			return rule.Name, true
+		}
+		for _, value := range values[rule.Name] {
+			if (searchQualifier{Key: rule.Name, Value: value}).matches(item, ctx) {
+				return rule.Name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// splitList splits a comma separated list and drops empty entries
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// withoutSecureNotes removes the secure notes unless the query asks for them with "type:note"
+func withoutSecureNotes(items []Item, q searchQuery) []Item {
+	for _, qualifier := range q.Qualifiers {
+		if qualifier.Key == "type" && !qualifier.Negate && getItemTypeByName(strings.ToLower(qualifier.Value)) == 2 {
+			return items
+		}
+	}
+	var kept []Item
+	for _, item := range items {
+		if item.Type != 2 {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// exclusionSummary describes the excluded items per rule, e.g. "3 by type, 1 by folder"
+func exclusionSummary(counts map[string]int) string {
+	var parts []string
+	for _, rule := range exclusionRuleKinds {
+		if counts[rule.Name] > 0 {
+			parts = append(parts, fmt.Sprintf("%d by %s", counts[rule.Name], rule.Title))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func Test_exclusionRules_excludes(t *testing.T) {
+	ctx := newSearchContext(
+		[]Folder{{Id: "f1", Name: "Archive"}, {Id: "f2", Name: "Archive/2019"}, {Id: "f3", Name: "Work"}},
+		[]Collection{{Id: "c1", Name: "Shared"}},
+		[]Organization{{Id: "o1", Name: "Acme"}},
+	)
+	rules := exclusionRules{
+		Types:         []string{"card"},
+		Folders:       []string{"archive"},
+		Organizations: []string{"Acme"},
+		Collections:   []string{"c1"},
+		Name:          regexp.MustCompile(`^tmp-`),
+	}
+	tests := []struct {
+		name     string
+		item     Item
+		wantRule string
+		want     bool
+	}{
+		{name: "kept", item: Item{Type: 1, Name: "GitHub", FolderId: "f3"}},
+		{name: "type", item: Item{Type: 3, Name: "Visa"}, wantRule: "type", want: true},
+		{name: "folder", item: Item{Type: 1, Name: "Old", FolderId: "f1"}, wantRule: "folder", want: true},
+		{name: "subfolder", item: Item{Type: 1, Name: "Older", FolderId: "f2"}, wantRule: "folder", want: true},
+		{name: "organization", item: Item{Type: 1, Name: "Team", OrganizationId: "o1"}, wantRule: "org", want: true},
+		{name: "collection by id", item: Item{Type: 1, Name: "Shared", CollectionIds: []string{"c2", "c1"}}, wantRule: "collection", want: true},
+		{name: "name regex", item: Item{Type: 1, Name: "tmp-login"}, wantRule: "name", want: true},
+		{name: "regex is case sensitive", item: Item{Type: 1, Name: "TMP-login"}},
+		{name: "first rule wins", item: Item{Type: 3, Name: "tmp-card", FolderId: "f1"}, wantRule: "type", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotRule, got := rules.excludes(tt.item, ctx)
+			if got != tt.want || gotRule != tt.wantRule {
+				t.Errorf("excludes() = %q, %v, want %q, %v", gotRule, got, tt.wantRule, tt.want)
+			}
+		})
+	}
+
+	if _, got := (exclusionRules{}).excludes(Item{Type: 2, Name: "Note"}, ctx); got {
+		t.Error("excludes() without rules excluded an item")
+	}
+}
+
+func Test_withoutSecureNotes(t *testing.T) {
+	items := []Item{{Id: "login", Type: 1}, {Id: "note", Type: 2}, {Id: "card", Type: 3}}
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{name: "plain search", query: "github", want: 2},
+		{name: "type note", query: "type:note github", want: 3},
+		{name: "type note upper case", query: "type:Note", want: 3},
+		{name: "negated type note", query: "-type:note", want: 2},
+		{name: "other type", query: "type:card", want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withoutSecureNotes(items, parseSearchQuery(tt.query)); len(got) != tt.want {
+				t.Errorf("withoutSecureNotes() returned %d items, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func Test_exclusionSummary(t *testing.T) {
+	got := exclusionSummary(map[string]int{"name": 1, "type": 3, "folder": 0})
+	if want := "3 by type, 1 by name"; got != want {
+		t.Errorf("exclusionSummary() = %q, want %q", got, want)
+	}
+}
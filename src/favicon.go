@@ -0,0 +1,258 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jpillora/go-tld"
+)
+
+// faviconDownloader fetches the favicons of the logins with a pool of workers and stores them as PNG files
+type faviconDownloader struct {
+	// workers is the number of icons downloaded at the same time
+	workers int
+	// maxSize is the maximum size of an icon in bytes, larger responses are rejected
+	maxSize int64
+	// retries is how often a temporary failure is retried, after backoff and twice as long for every further retry
+	retries int
+	backoff time.Duration
+	// providers are tried in order until one has the icon
+	providers []faviconProvider
+	client    *http.Client
+	sleep     func(time.Duration)
+}
+
+func newFaviconDownloader() (*faviconDownloader, error) {
+	client := &http.Client{Timeout: time.Duration(conf.IconDownloadTimeout) * time.Second}
+	providers, err := parseFaviconProviders(conf.IconProviders, conf.IconUrlTemplate, conf.Server, client)
+	if err != nil {
+		return nil, err
+	}
+	return &faviconDownloader{
+		workers:   conf.IconDownloadWorkers,
+		maxSize:   int64(conf.IconMaxSize) * 1024,
+		retries:   conf.IconDownloadRetries,
+		backoff:   time.Second,
+		providers: providers,
+		client:    client,
+		sleep:     time.Sleep,
+	}, nil
+}
+
+// iconDownloadResult counts the icons of a download run
+type iconDownloadResult struct {
+	Downloaded int
+	Skipped    int
+	Failed     int
+}
+
+// download fetches the icons of the URLs by domain into the folder as "<domain>.png", existing icons are skipped
+func (d *faviconDownloader) download(urls map[string]string, folder string) iconDownloadResult {
+	var (
+		result iconDownloadResult
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+	)
+	count := func(counter *int) {
+		mu.Lock()
+		*counter++
+		mu.Unlock()
+	}
+
+	domains := make(chan string)
+	workers := d.workers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for domain := range domains {
+				filePath := filepath.Join(folder, fmt.Sprintf("%s.png", domain))
+				if _, err := os.Stat(filePath); err == nil {
+					count(&result.Skipped)
+					continue
+				}
+				if err := d.downloadIcon(urls[domain], filePath); err != nil {
+					log.Printf("Couldn't download the icon of %s, error: %s", urls[domain], err)
+					count(&result.Failed)
+					continue
+				}
+				count(&result.Downloaded)
+			}
+		}()
+	}
+	for domain := range urls {
+		domains <- domain
+	}
+	close(domains)
+	wg.Wait()
+	return result
+}
+
+// downloadIcon fetches the favicon of the site of the URL from the first provider which has it,
+// converts it to PNG and writes it to the file
+func (d *faviconDownloader) downloadIcon(loginUrl string, filePath string) error {
+	site, err := siteUrl(loginUrl)
+	if err != nil {
+		return err
+	}
+	lastErr := fmt.Errorf("no icon for %s", site.Host)
+	for _, provider := range d.providers {
+		iconUrls, err := provider.iconUrls(site)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, iconUrl := range iconUrls {
+			data, err := d.fetchPng(iconUrl)
+			if err == nil {
+				return writeIcon(filePath, data)
+			}
+			debugLog(fmt.Sprintf("No icon at %s, error: %s", iconUrl, err))
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// writeIcon writes the icon to a temporary file first, so the search only sees complete icons
+func writeIcon(filePath string, data []byte) error {
+	tmpPath := filePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filePath)
+}
+
+// fetchPng downloads the icon and converts it to PNG
+func (d *faviconDownloader) fetchPng(iconUrl string) ([]byte, error) {
+	body, contentType, err := d.fetch(iconUrl)
+	if err != nil {
+		return nil, err
+	}
+	data, err := iconToPng(body, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", iconUrl, err)
+	}
+	return data, nil
+}
+
+// siteUrl returns the scheme and host of the login URL, URLs without scheme are websites
+func siteUrl(loginUrl string) (*url.URL, error) {
+	if !strings.HasPrefix(loginUrl, "http") {
+		loginUrl = fmt.Sprintf("http://%s", loginUrl)
+	}
+	u, err := tld.Parse(loginUrl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("no host in %s", loginUrl)
+	}
+	return &url.URL{Scheme: u.Scheme, Host: u.Host}, nil
+}
+
+// fetch requests the icon, retrying temporary failures, and returns it with its content type
+func (d *faviconDownloader) fetch(url string) ([]byte, string, error) {
+	wait := d.backoff
+	for attempt := 0; ; attempt++ {
+		body, contentType, temporary, err := d.get(url)
+		if err == nil || !temporary || attempt >= d.retries {
+			return body, contentType, err
+		}
+		log.Printf("Retrying %s in %s, error: %s", url, wait, err)
+		d.sleep(wait)
+		wait *= 2
+	}
+}
+
+// get requests the icon once, it reports whether a failure is temporary and worth a retry
+func (d *faviconDownloader) get(url string) (body []byte, contentType string, temporary bool, err error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", false, err
+	}
+	req.Header.Set("User-Agent", WORKFLOW_NAME)
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, "", true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		temporary = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return nil, "", temporary, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	if resp.ContentLength > d.maxSize {
+		return nil, "", false, fmt.Errorf("%s: icon larger than %d bytes", url, d.maxSize)
+	}
+	body, err = io.ReadAll(io.LimitReader(resp.Body, d.maxSize+1))
+	if err != nil {
+		return nil, "", true, err
+	}
+	if int64(len(body)) > d.maxSize {
+		return nil, "", false, fmt.Errorf("%s: icon larger than %d bytes", url, d.maxSize)
+	}
+	contentType, err = iconContentType(resp.Header.Get("Content-Type"), body)
+	if err != nil {
+		return nil, "", false, fmt.Errorf("%s: %w", url, err)
+	}
+	return body, contentType, false, nil
+}
+
+// iconContentType returns the media type of the response, it's sniffed if the server doesn't send a specific one.
+// Anything but an image, e.g. the HTML error page of a site, is rejected.
+func iconContentType(header string, body []byte) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil || mediaType == "" || mediaType == "application/octet-stream" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(body))
+	}
+	if !strings.HasPrefix(mediaType, "image/") {
+		return "", fmt.Errorf("not an image but %s", mediaType)
+	}
+	return mediaType, nil
+}
+
+// iconToPng converts the icon to PNG, PNG files are only checked, even if they are served as another type
+func iconToPng(body []byte, contentType string) ([]byte, error) {
+	var img image.Image
+	var err error
+	switch {
+	case bytes.HasPrefix(body, pngMagic):
+		if _, err := png.DecodeConfig(bytes.NewReader(body)); err != nil {
+			return nil, fmt.Errorf("invalid PNG: %w", err)
+		}
+		return body, nil
+	case contentType == "image/x-icon" || contentType == "image/vnd.microsoft.icon":
+		img, err = decodeIco(body)
+	default:
+		img, _, err = image.Decode(bytes.NewReader(body))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't convert %s: %w", contentType, err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
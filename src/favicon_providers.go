@@ -0,0 +1,162 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// only the head of a page is needed to find its icons
+const maxFaviconPageSize = 512 * 1024
+
+// faviconProvider knows where the favicon of a site can be downloaded
+type faviconProvider interface {
+	// iconUrls returns the URLs of the favicon of the site, they are tried in order
+	iconUrls(site *url.URL) ([]string, error)
+}
+
+// templateProvider is a favicon service, "{host}" in the URL is replaced with the host of the site
+type templateProvider string
+
+func (p templateProvider) iconUrls(site *url.URL) ([]string, error) {
+	return []string{strings.ReplaceAll(string(p), "{host}", url.PathEscape(site.Hostname()))}, nil
+}
+
+// directProvider downloads the favicon from the site itself, the icons linked in its HTML are tried first
+type directProvider struct {
+	client *http.Client
+}
+
+func (p directProvider) iconUrls(site *url.URL) ([]string, error) {
+	base := &url.URL{Scheme: site.Scheme, Host: site.Host, Path: "/"}
+	var urls []string
+	page, err := p.page(base.String())
+	if err == nil {
+		urls = htmlIconLinks(base, page)
+	}
+	urls = append(urls, base.ResolveReference(&url.URL{Path: "/favicon.ico"}).String())
+	return urls, nil
+}
+
+// page returns the start of the HTML page at the URL
+func (p directProvider) page(pageUrl string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, pageUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", WORKFLOW_NAME)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", pageUrl, resp.Status)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" {
+		return nil, fmt.Errorf("%s: not a HTML page but %s", pageUrl, mediaType)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxFaviconPageSize))
+}
+
+// htmlIconLinks returns the icons of the <link rel="icon"> tags of the page resolved against its URL,
+// the apple-touch-icon is usually the largest and comes first
+func htmlIconLinks(base *url.URL, page []byte) []string {
+	var touchIcons, icons []string
+	tokenizer := html.NewTokenizer(bytes.NewReader(page))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+		name, hasAttr := tokenizer.TagName()
+		if string(name) == "body" {
+			break
+		}
+		if string(name) != "link" || !hasAttr {
+			continue
+		}
+		var rel, href string
+		for hasAttr {
+			var key, value []byte
+			key, value, hasAttr = tokenizer.TagAttr()
+			switch string(key) {
+			case "rel":
+				rel = strings.ToLower(string(value))
+			case "href":
+				href = strings.TrimSpace(string(value))
+			}
+		}
+		ref, err := url.Parse(href)
+		if href == "" || err != nil {
+			continue
+		}
+		for _, token := range strings.Fields(rel) {
+			if token == "apple-touch-icon" || token == "apple-touch-icon-precomposed" {
+				touchIcons = append(touchIcons, base.ResolveReference(ref).String())
+				break
+			}
+			if token == "icon" {
+				icons = append(icons, base.ResolveReference(ref).String())
+				break
+			}
+		}
+	}
+	return append(touchIcons, icons...)
+}
+
+// bitwardenIconsUrl returns the icons service of the Bitwarden server, self-hosted servers and Vaultwarden serve it at /icons
+func bitwardenIconsUrl(server string) string {
+	server = strings.TrimSuffix(server, "/")
+	u, err := url.Parse(server)
+	if err != nil {
+		return "https://icons.bitwarden.net"
+	}
+	switch strings.ToLower(u.Hostname()) {
+	case "", "bitwarden.com", "vault.bitwarden.com":
+		return "https://icons.bitwarden.net"
+	case "bitwarden.eu", "vault.bitwarden.eu":
+		return "https://icons.bitwarden.eu"
+	}
+	return server + "/icons"
+}
+
+// parseFaviconProviders returns the providers of the comma separated list of names in the order they are tried
+func parseFaviconProviders(names string, template string, server string, client *http.Client) ([]faviconProvider, error) {
+	var providers []faviconProvider
+	for _, name := range splitList(names) {
+		switch strings.ToLower(name) {
+		case "duckduckgo":
+			providers = append(providers, templateProvider("https://icons.duckduckgo.com/ip3/{host}.ico"))
+		case "google":
+			providers = append(providers, templateProvider("https://www.google.com/s2/favicons?domain={host}&sz=64"))
+		case "bitwarden":
+			providers = append(providers, templateProvider(bitwardenIconsUrl(server)+"/{host}/icon.png"))
+		case "direct":
+			providers = append(providers, directProvider{client: client})
+		case "custom":
+			if !strings.Contains(template, "{host}") {
+				return nil, fmt.Errorf("ICON_URL_TEMPLATE %q must contain {host}", template)
+			}
+			providers = append(providers, templateProvider(template))
+		default:
+			return nil, fmt.Errorf("unknown icon provider %q, expected duckduckgo, google, bitwarden, direct or custom", name)
+		}
+	}
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("no icon provider set in ICON_PROVIDERS")
+	}
+	return providers, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_htmlIconLinks(t *testing.T) {
+	base, _ := url.Parse("https://example.com/")
+	page := []byte(`<!DOCTYPE html>
+<html><head>
+<link rel="stylesheet" href="/style.css">
+<link rel="shortcut icon" href="/static/favicon.ico">
+<LINK REL="Icon" type="image/png" href="https://cdn.example.com/icon-32.png" />
+<link rel="apple-touch-icon" href="touch.png">
+<link rel="icon" href="">
+</head><body>
+<link rel="icon" href="/ignored.png">
+</body></html>`)
+	want := []string{
+		"https://example.com/touch.png",
+		"https://example.com/static/favicon.ico",
+		"https://cdn.example.com/icon-32.png",
+	}
+	if got := htmlIconLinks(base, page); !reflect.DeepEqual(got, want) {
+		t.Errorf("htmlIconLinks() = %v, want %v", got, want)
+	}
+}
+
+func Test_bitwardenIconsUrl(t *testing.T) {
+	tests := []struct {
+		server string
+		want   string
+	}{
+		{server: "https://bitwarden.com", want: "https://icons.bitwarden.net"},
+		{server: "https://vault.bitwarden.eu/", want: "https://icons.bitwarden.eu"},
+		{server: "https://vault.example.com/", want: "https://vault.example.com/icons"},
+		{server: "https://example.com/vaultwarden", want: "https://example.com/vaultwarden/icons"},
+		{server: "", want: "https://icons.bitwarden.net"},
+	}
+	for _, tt := range tests {
+		if got := bitwardenIconsUrl(tt.server); got != tt.want {
+			t.Errorf("bitwardenIconsUrl(%q) = %q, want %q", tt.server, got, tt.want)
+		}
+	}
+}
+
+func Test_parseFaviconProviders(t *testing.T) {
+	site, _ := url.Parse("https://login.example.com:8443")
+	tests := []struct {
+		name     string
+		names    string
+		template string
+		want     []string
+		wantErr  bool
+	}{
+		{name: "duckduckgo", names: "duckduckgo", want: []string{"https://icons.duckduckgo.com/ip3/login.example.com.ico"}},
+		{name: "in order", names: "bitwarden, Google", want: []string{
+			"https://vault.example.com/icons/login.example.com/icon.png",
+			"https://www.google.com/s2/favicons?domain=login.example.com&sz=64",
+		}},
+		{name: "custom", names: "custom", template: "https://icons.example.com/{host}.png", want: []string{"https://icons.example.com/login.example.com.png"}},
+		{name: "custom without host", names: "custom", template: "https://icons.example.com/icon.png", wantErr: true},
+		{name: "unknown", names: "duckduckgo,yahoo", wantErr: true},
+		{name: "empty", names: " , ", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			providers, err := parseFaviconProviders(tt.names, tt.template, "https://vault.example.com", http.DefaultClient)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFaviconProviders() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, provider := range providers {
+				urls, _ := provider.iconUrls(site)
+				got = append(got, urls...)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("iconUrls() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_faviconDownloader_fallback(t *testing.T) {
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<html><head><link rel="icon" href="/missing.png"><link rel="icon" href="/assets/icon.png"></head></html>`))
+		case "/assets/icon.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(testPng(color.Black))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	downloader := &faviconDownloader{
+		workers: 1,
+		maxSize: 1024,
+		providers: []faviconProvider{
+			templateProvider(server.URL + "/service/{host}.ico"),
+			directProvider{client: server.Client()},
+		},
+		client: server.Client(),
+	}
+	filePath := filepath.Join(t.TempDir(), "item.png")
+	if err := downloader.downloadIcon(server.URL+"/login", filePath); err != nil {
+		t.Fatalf("downloadIcon() error = %v", err)
+	}
+	if data, err := os.ReadFile(filePath); err != nil || !bytes.HasPrefix(data, pngMagic) {
+		t.Errorf("icon isn't a PNG: %v", err)
+	}
+	want := []string{"/service/127.0.0.1.ico", "/", "/missing.png", "/assets/icon.png"}
+	if !reflect.DeepEqual(requested, want) {
+		t.Errorf("requested = %v, want %v", requested, want)
+	}
+
+	requested = nil
+	downloader.providers = downloader.providers[:1]
+	if err := downloader.downloadIcon(server.URL+"/login", filepath.Join(t.TempDir(), "item.png")); err == nil {
+		t.Error("downloadIcon() error = nil without a provider having the icon")
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testIco builds an ICO file of the images, each one is a PNG or a bitmap without file header
+func testIco(entries ...[]byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint16{0, 1, uint16(len(entries))})
+	offset := 6 + 16*len(entries)
+	for i, data := range entries {
+		// the first entry is the smallest
+		size := byte(16 * (i + 1))
+		buf.Write([]byte{size, size, 0, 0})
+		binary.Write(&buf, binary.LittleEndian, []uint16{1, 32})
+		binary.Write(&buf, binary.LittleEndian, []uint32{uint32(len(data)), uint32(offset)})
+		offset += len(data)
+	}
+	for _, data := range entries {
+		buf.Write(data)
+	}
+	return buf.Bytes()
+}
+
+// testIcoBitmap builds a 2x2 bitmap of an ICO file with 1 bit per pixel, the top left pixel is masked
+func testIcoBitmap() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{40, 2, 4})
+	binary.Write(&buf, binary.LittleEndian, []uint16{1, 1})
+	binary.Write(&buf, binary.LittleEndian, []uint32{0, 0, 0, 0, 2, 0})
+	// palette: black, red
+	buf.Write([]byte{0, 0, 0, 0, 0, 0, 0xff, 0})
+	// color rows bottom-up: bottom row red, black; top row black, red
+	buf.Write([]byte{0x80, 0, 0, 0, 0x40, 0, 0, 0})
+	// mask rows bottom-up
+	buf.Write([]byte{0, 0, 0, 0, 0x80, 0, 0, 0})
+	return buf.Bytes()
+}
+
+func testPng(c color.Color) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, c)
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+func Test_decodeIco(t *testing.T) {
+	red := color.NRGBA{R: 0xff, A: 0xff}
+
+	img, err := decodeIco(testIco(testPng(color.Black), testPng(red)))
+	if err != nil {
+		t.Fatalf("decodeIco() error = %v", err)
+	}
+	if got := color.NRGBAModel.Convert(img.At(0, 0)); got != red {
+		t.Errorf("decodeIco() didn't choose the largest image, pixel = %v", got)
+	}
+
+	img, err = decodeIco(testIco(testIcoBitmap()))
+	if err != nil {
+		t.Fatalf("decodeIco() bitmap error = %v", err)
+	}
+	want := map[image.Point]color.NRGBA{
+		{0, 0}: {A: 0},
+		{1, 0}: red,
+		{0, 1}: red,
+		{1, 1}: {A: 0xff},
+	}
+	for p, c := range want {
+		if got := img.At(p.X, p.Y).(color.NRGBA); got != c {
+			t.Errorf("pixel %v = %v, want %v", p, got, c)
+		}
+	}
+
+	for name, data := range map[string][]byte{
+		"empty":         nil,
+		"not an icon":   []byte("<html></html>"),
+		"out of bounds": testIco(testPng(red))[:30],
+	} {
+		if _, err := decodeIco(data); err == nil {
+			t.Errorf("decodeIco(%s) error = nil", name)
+		}
+	}
+}
+
+func Test_iconContentType(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		body    []byte
+		want    string
+		wantErr bool
+	}{
+		{name: "header", header: "image/png", body: testPng(color.Black), want: "image/png"},
+		{name: "parameters", header: "image/x-icon; charset=binary", want: "image/x-icon"},
+		{name: "sniffed", header: "application/octet-stream", body: testIco(testPng(color.Black)), want: "image/x-icon"},
+		{name: "missing", body: testPng(color.Black), want: "image/png"},
+		{name: "error page", header: "text/html; charset=utf-8", body: []byte("<html>Not found</html>"), wantErr: true},
+		{name: "sniffed error page", body: []byte("<!DOCTYPE html><html></html>"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := iconContentType(tt.header, tt.body)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("iconContentType() = %q, %v, want %q, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_iconToPng(t *testing.T) {
+	var gifData bytes.Buffer
+	gif.Encode(&gifData, image.NewPaletted(image.Rect(0, 0, 3, 3), color.Palette{color.White}), nil)
+
+	for name, icon := range map[string]struct {
+		body        []byte
+		contentType string
+	}{
+		"png":            {body: testPng(color.Black), contentType: "image/png"},
+		"png served ico": {body: testPng(color.Black), contentType: "image/x-icon"},
+		"ico":            {body: testIco(testIcoBitmap()), contentType: "image/vnd.microsoft.icon"},
+		"gif":            {body: gifData.Bytes(), contentType: "image/gif"},
+	} {
+		data, err := iconToPng(icon.body, icon.contentType)
+		if err != nil {
+			t.Errorf("iconToPng(%s) error = %v", name, err)
+			continue
+		}
+		if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+			t.Errorf("iconToPng(%s) isn't a PNG: %v", name, err)
+		}
+	}
+	if _, err := iconToPng([]byte("<svg></svg>"), "image/svg+xml"); err == nil {
+		t.Error("iconToPng(svg) error = nil")
+	}
+}
+
+func Test_faviconDownloader(t *testing.T) {
+	var (
+		mu               sync.Mutex
+		active, maxCount int
+		attempts         = map[string]int{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/ip3/"), ".example.com.ico")
+		mu.Lock()
+		active++
+		if active > maxCount {
+			maxCount = active
+		}
+		attempts[name]++
+		attempt := attempts[name]
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			active--
+			mu.Unlock()
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		switch {
+		case name == "ico":
+			w.Header().Set("Content-Type", "image/x-icon")
+			w.Write(testIco(testIcoBitmap()))
+		case name == "html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html>Error</html>"))
+		case name == "large":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(append(testPng(color.Black), make([]byte, 2048)...))
+		case name == "flaky" && attempt < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case name == "missing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(testPng(color.Black))
+		}
+	}))
+	defer server.Close()
+
+	var slept []time.Duration
+	downloader := &faviconDownloader{
+		workers: 2,
+		maxSize: 1024,
+		retries: 2,
+		backoff: time.Second,
+		// the favicon of <name>.example.com is requested at /ip3/<name>.example.com.ico
+		providers: []faviconProvider{templateProvider(server.URL + "/ip3/{host}.ico")},
+		client:    server.Client(),
+		sleep: func(d time.Duration) {
+			mu.Lock()
+			slept = append(slept, d)
+			mu.Unlock()
+		},
+	}
+
+	folder := t.TempDir()
+	if err := os.WriteFile(filepath.Join(folder, "existing.png"), testPng(color.White), 0600); err != nil {
+		t.Fatal(err)
+	}
+	urls := map[string]string{}
+	for _, name := range []string{"existing", "png", "ico", "flaky", "html", "large", "missing"} {
+		urls[name] = "https://" + name + ".example.com/login"
+	}
+	result := downloader.download(urls, folder)
+
+	if want := (iconDownloadResult{Downloaded: 3, Skipped: 1, Failed: 3}); result != want {
+		t.Errorf("result = %+v, want %+v", result, want)
+	}
+	if attempts["flaky"] != 3 || attempts["missing"] != 1 || attempts["html"] != 1 || attempts["existing"] != 0 {
+		t.Errorf("attempts = %v, want 3 for flaky, 1 for missing and html and none for existing", attempts)
+	}
+	if len(slept) != 2 || slept[0] != time.Second || slept[1] != 2*time.Second {
+		t.Errorf("slept = %v, want [1s 2s]", slept)
+	}
+	for _, id := range []string{"png", "ico", "flaky"} {
+		data, err := os.ReadFile(filepath.Join(folder, id+".png"))
+		if err != nil || !bytes.HasPrefix(data, pngMagic) {
+			t.Errorf("icon %s isn't a PNG: %v", id, err)
+		}
+	}
+	for _, id := range []string{"html", "large", "missing"} {
+		if _, err := os.Stat(filepath.Join(folder, id+".png")); !os.IsNotExist(err) {
+			t.Errorf("icon %s was written", id)
+		}
+	}
+
+	t.Run("workers run concurrently up to the limit", func(t *testing.T) {
+		maxCount = 0
+		downloader.workers = 3
+		urls := map[string]string{}
+		for _, id := range strings.Split("a b c d e f g h i", " ") {
+			urls[id] = id + ".example.com"
+		}
+		result := downloader.download(urls, t.TempDir())
+		if result.Downloaded != len(urls) {
+			t.Errorf("result = %+v, want %d downloaded", result, len(urls))
+		}
+		if maxCount < 2 || maxCount > 3 {
+			t.Errorf("concurrent requests = %d, want 2 to 3", maxCount)
+		}
+	})
+}
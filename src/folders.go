@@ -0,0 +1,268 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Bitwarden nests folders through "/" in the folder name, e.g. "Work/Infra/AWS".
+// A parent like "Work" doesn't need to exist as folder itself.
+const folderSeparator = "/"
+
+// folderNode is one folder of a level in the folder tree
+type folderNode struct {
+	Name string
+	Path string
+	// Id is empty if no folder exists with this path, only its subfolders
+	Id          string
+	Subfolders  int
+	DirectItems int
+	TotalItems  int
+}
+
+func parentFolderPath(path string) string {
+	i := strings.LastIndex(path, folderSeparator)
+	if i < 0 {
+		return ""
+	}
+	return path[:i]
+}
+
+func isInFolderPath(name string, path string) bool {
+	return name == path || strings.HasPrefix(name, path+folderSeparator)
+}
+
+// folderChildren returns the folders directly below the parent path, "" is the root.
+// The item counts of a node include the items of all its subfolders.
+func folderChildren(folders []Folder, items []Item, parent string) []folderNode {
+	folderNames := map[string]string{}
+	for _, folder := range folders {
+		folderNames[folder.Id] = folder.Name
+	}
+
+	var nodes []*folderNode
+	byPath := map[string]*folderNode{}
+	// a subfolder is counted once, even if it has subfolders itself or only exists as their parent
+	subfolders := map[string]bool{}
+	for _, folder := range folders {
+		// the "No Folder" entry has no id
+		if folder.Id == "" {
+			continue
+		}
+		rel := folder.Name
+		if parent != "" {
+			if !strings.HasPrefix(folder.Name, parent+folderSeparator) {
+				continue
+			}
+			rel = strings.TrimPrefix(folder.Name, parent+folderSeparator)
+		}
+		segment, rest, nested := strings.Cut(rel, folderSeparator)
+		path := segment
+		if parent != "" {
+			path = parent + folderSeparator + segment
+		}
+		node, ok := byPath[path]
+		if !ok {
+			node = &folderNode{Name: segment, Path: path}
+			byPath[path] = node
+			nodes = append(nodes, node)
+		}
+		if nested && rest != "" {
+			child, _, _ := strings.Cut(rest, folderSeparator)
+			if !subfolders[path+folderSeparator+child] {
+				subfolders[path+folderSeparator+child] = true
+				node.Subfolders++
+			}
+		} else {
+			node.Id = folder.Id
+		}
+	}
+
+	for _, item := range items {
+		if item.FolderId == "" {
+			continue
+		}
+		name := folderNames[item.FolderId]
+		for _, node := range nodes {
+			if isInFolderPath(name, node.Path) {
+				node.TotalItems++
+				if item.FolderId == node.Id {
+					node.DirectItems++
+				}
+			}
+		}
+	}
+
+	children := make([]folderNode, 0, len(nodes))
+	for _, node := range nodes {
+		children = append(children, *node)
+	}
+	return children
+}
+
+// folderItems returns the items in the folder with the path and, if recursive, in its subfolders
+func folderItems(folders []Folder, items []Item, path string, recursive bool) []Item {
+	folderNames := map[string]string{}
+	for _, folder := range folders {
+		folderNames[folder.Id] = folder.Name
+	}
+	var found []Item
+	for _, item := range items {
+		if item.FolderId == "" {
+			continue
+		}
+		name := folderNames[item.FolderId]
+		if name == path || (recursive && isInFolderPath(name, path)) {
+			found = append(found, item)
+		}
+	}
+	return found
+}
+
+// encodeFolderPath makes the path safe to pass as workflow variable, folder names can contain spaces
+func encodeFolderPath(path string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(path))
+}
+
+func decodeFolderPath(encoded string) (string, error) {
+	path, err := base64.RawURLEncoding.DecodeString(encoded)
+	return string(path), err
+}
+
+// folderBreadcrumbs shows the path like "Folders › Work › Infra"
+func folderBreadcrumbs(path string) string {
+	crumbs := []string{"Folders"}
+	if path != "" {
+		crumbs = append(crumbs, strings.Split(path, folderSeparator)...)
+	}
+	return strings.Join(crumbs, " › ")
+}
+
+// addFolderLevelItems adds the folder level of the query to Alfred. The query is the path of the
+// level followed by the filter, e.g. "Work/Infra/aws" shows the folders below "Work/Infra" matching "aws".
+func addFolderLevelItems(items []Item, folders []Folder, query string) (filter string) {
+	path := parentFolderPath(query)
+	filter = strings.TrimPrefix(strings.TrimPrefix(query, path), folderSeparator)
+	if strings.HasSuffix(query, folderSeparator) {
+		path = strings.TrimSuffix(query, folderSeparator)
+		filter = ""
+	}
+
+	if path == "" {
+		addBackToNormalSearchItem()
+	} else {
+		addFolderUpItem(path)
+
+		current := folderChildren(folders, items, parentFolderPath(path))
+		for _, node := range current {
+			if node.Path != path {
+				continue
+			}
+			if node.Id != "" {
+				wf.NewItem(fmt.Sprintf("Items directly in %s", node.Name)).
+					Subtitle(fmt.Sprintf("Number of items: %d", node.DirectItems)).Valid(true).
+					UID(node.Id).
+					Icon(iconFolderOpen).
+					Var("action", "-folder").
+					Var("action2", fmt.Sprintf("-id %s ", node.Id))
+			}
+			wf.NewItem(fmt.Sprintf("Items in %s and subfolders", node.Name)).
+				Subtitle(fmt.Sprintf("Number of items: %d", node.TotalItems)).Valid(true).
+				UID(fmt.Sprintf("%s/*", node.Path)).
+				Icon(iconFolderOpen).
+				Var("action", "-folder").
+				Var("action2", fmt.Sprintf("-path %s ", encodeFolderPath(node.Path)))
+		}
+	}
+
+	for _, node := range folderChildren(folders, items, path) {
+		subtitle := fmt.Sprintf("Number of items: %d", node.TotalItems)
+		if node.Subfolders > 0 {
+			subtitle = fmt.Sprintf("%s, %d directly, %d subfolders, ↩ or ⇥ open", subtitle, node.DirectItems, node.Subfolders)
+			wf.NewItem(node.Name).
+				Subtitle(subtitle).
+				Valid(false).
+				UID(node.Path).
+				Autocomplete(folderLevelQuery(node.Path)).
+				Icon(iconFolder)
+			continue
+		}
+		wf.NewItem(node.Name).
+			Subtitle(subtitle).Valid(true).
+			UID(node.Id).
+			Icon(iconFolderOpen).
+			Var("action", "-folder").
+			Var("action2", fmt.Sprintf("-id %s ", node.Id))
+	}
+
+	if path == "" {
+		// items without folder
+		for _, folder := range folders {
+			if folder.Id == "" {
+				wf.NewItem(folder.Name).
+					Subtitle(fmt.Sprintf("Number of items: %d", getItemsInFolderCount("", items))).Valid(true).
+					UID("null").
+					Icon(iconFolderOpen).
+					Var("action", "-folder").
+					Var("action2", "-id null ")
+			}
+		}
+	}
+	return filter
+}
+
+// addFolderUpItem shows the breadcrumbs of the path, selecting it goes up one level
+func addFolderUpItem(path string) {
+	it := wf.NewItem(folderBreadcrumbs(path)).
+		Subtitle("↩ or ⇥ go up one level").
+		Icon(iconLevelUp)
+	parent := parentFolderPath(path)
+	if parent == "" {
+		// an empty autocomplete is ignored by Alfred, so the root is opened with the keyword
+		it.Valid(true).
+			UID("").
+			Var("action", "-search").
+			Arg(conf.BwfKeyword)
+		return
+	}
+	it.Valid(false).Autocomplete(folderLevelQuery(parent))
+}
+
+// folderLevelQuery is the query which opens the level of the path
+func folderLevelQuery(path string) string {
+	if path == "" {
+		return ""
+	}
+	return path + folderSeparator
+}
+
+// addAllFoldersItems adds every folder with its full path, used to search through the whole tree
+func addAllFoldersItems(items []Item, folders []Folder) {
+	addBackToNormalSearchItem()
+	for _, folder := range folders {
+		id := "null"
+		if folder.Id != "" {
+			id = folder.Id
+		}
+		direct := getItemsInFolderCount(folder.Id, items)
+		subtitle := fmt.Sprintf("Number of items: %d", direct)
+		// the count includes the items of the subfolders
+		if total := len(folderItems(folders, items, folder.Name, true)); folder.Id != "" && total != direct {
+			subtitle = fmt.Sprintf("Number of items: %d, %d directly", total, direct)
+		}
+		it := wf.NewItem(folder.Name).
+			Subtitle(subtitle).Valid(true).
+			UID(id).
+			Icon(iconFolderOpen).
+			Var("action", "-folder").
+			Var("action2", fmt.Sprintf("-id %s ", id))
+		// ⇥ opens the level of the folder in the tree
+		if folder.Id != "" {
+			it.Autocomplete(folderLevelQuery(folder.Name))
+		}
+	}
+}
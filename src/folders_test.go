@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_folderChildren(t *testing.T) {
+	folders := []Folder{
+		{Id: "", Name: "No Folder"},
+		{Id: "1", Name: "Private"},
+		{Id: "2", Name: "Work"},
+		{Id: "3", Name: "Work/Infra"},
+		{Id: "4", Name: "Work/Infra/AWS"},
+		{Id: "6", Name: "Work/Infra/GCP"},
+		// "Clients" only exists as parent of its subfolder
+		{Id: "5", Name: "Clients/ACME"},
+	}
+	items := []Item{
+		{Id: "a", FolderId: "2"},
+		{Id: "b", FolderId: "3"},
+		{Id: "c", FolderId: "4"},
+		{Id: "d", FolderId: "4"},
+		{Id: "e", FolderId: "5"},
+		{Id: "f", FolderId: ""},
+	}
+	tests := []struct {
+		name   string
+		parent string
+		want   []folderNode
+	}{
+		{
+			name:   "root",
+			parent: "",
+			want: []folderNode{
+				{Name: "Private", Path: "Private", Id: "1"},
+				{Name: "Work", Path: "Work", Id: "2", Subfolders: 1, DirectItems: 1, TotalItems: 4},
+				{Name: "Clients", Path: "Clients", Subfolders: 1, TotalItems: 1},
+			},
+		},
+		{
+			name:   "nested",
+			parent: "Work",
+			want: []folderNode{
+				{Name: "Infra", Path: "Work/Infra", Id: "3", Subfolders: 2, DirectItems: 1, TotalItems: 3},
+			},
+		},
+		{
+			name:   "leaf",
+			parent: "Work/Infra",
+			want: []folderNode{
+				{Name: "AWS", Path: "Work/Infra/AWS", Id: "4", DirectItems: 2, TotalItems: 2},
+				{Name: "GCP", Path: "Work/Infra/GCP", Id: "6"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := folderChildren(folders, items, tt.parent); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("folderChildren() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("folderItems", func(t *testing.T) {
+		var direct, recursive []string
+		for _, item := range folderItems(folders, items, "Work/Infra", false) {
+			direct = append(direct, item.Id)
+		}
+		for _, item := range folderItems(folders, items, "Work/Infra", true) {
+			recursive = append(recursive, item.Id)
+		}
+		if !reflect.DeepEqual(direct, []string{"b"}) || !reflect.DeepEqual(recursive, []string{"b", "c", "d"}) {
+			t.Errorf("folderItems() = %v and %v", direct, recursive)
+		}
+	})
+}
@@ -0,0 +1,312 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	hibpKeyName = "hibpPassword"
+	// the progress of the check is stored after this many passwords
+	breachCheckSaveEvery = 100
+)
+
+// errHibpUnavailable stops the check, the other passwords would fail the same way
+var errHibpUnavailable = errors.New("Have I Been Pwned is unavailable")
+
+// pwnedClient checks passwords against Have I Been Pwned with the k-anonymity range API:
+// only the first 5 characters of the SHA-1 hash are sent, the suffix is compared locally.
+type pwnedClient struct {
+	// baseURL is the API endpoint, the range is requested at <baseURL>/range/<prefix>
+	baseURL string
+	// mirror is a directory with the range files "<PREFIX>.txt" of a local copy, it replaces the API
+	mirror string
+	// interval is the minimum time between two requests
+	interval time.Duration
+	client   *http.Client
+
+	lastRequest time.Time
+	ranges      map[string][]byte
+	now         func() time.Time
+	sleep       func(time.Duration)
+}
+
+func newPwnedClient() *pwnedClient {
+	return &pwnedClient{
+		baseURL:  strings.TrimSuffix(conf.HibpApiUrl, "/"),
+		mirror:   conf.HibpMirror,
+		interval: time.Duration(conf.HibpRequestInterval) * time.Millisecond,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		ranges:   map[string][]byte{},
+		now:      time.Now,
+		sleep:    time.Sleep,
+	}
+}
+
+// count returns how often the password was seen in data breaches
+func (c *pwnedClient) count(password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	body, err := c.rangeBody(prefix)
+	if err != nil {
+		return 0, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		lineSuffix, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || !strings.EqualFold(lineSuffix, suffix) {
+			continue
+		}
+		// padding entries have a count of 0
+		return strconv.Atoi(count)
+	}
+	return 0, scanner.Err()
+}
+
+// rangeBody returns the hash suffixes of the prefix from the mirror or the API. The ranges are only kept in memory,
+// the prefixes of a vault's passwords on disk would narrow them down.
+func (c *pwnedClient) rangeBody(prefix string) ([]byte, error) {
+	if body, ok := c.ranges[prefix]; ok {
+		return body, nil
+	}
+	if c.mirror != "" {
+		body, err := os.ReadFile(filepath.Join(c.mirror, prefix+".txt"))
+		if err != nil {
+			return nil, fmt.Errorf("reading range %s from the mirror: %w", prefix, err)
+		}
+		c.ranges[prefix] = body
+		return body, nil
+	}
+
+	body, err := c.fetchRange(prefix)
+	if err != nil {
+		return nil, err
+	}
+	c.ranges[prefix] = body
+	return body, nil
+}
+
+// removeHibpRangeCache removes the ranges which older versions cached in plain text
+func removeHibpRangeCache() error {
+	return os.RemoveAll(filepath.Join(wf.CacheDir(), "hibp"))
+}
+
+// fetchRange requests the range from the API, waiting for the interval since the last request.
+// If the API answers with 429 Too Many Requests it's retried once after the time it asks for.
+func (c *pwnedClient) fetchRange(prefix string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		if wait := c.interval - c.now().Sub(c.lastRequest); wait > 0 {
+			c.sleep(wait)
+		}
+		c.lastRequest = c.now()
+
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/range/%s", c.baseURL, prefix), nil)
+		if err != nil {
+			return nil, err
+		}
+		// padding hides the number of suffixes of the prefix from anyone watching the response size
+		req.Header.Set("Add-Padding", "true")
+		req.Header.Set("User-Agent", WORKFLOW_NAME)
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errHibpUnavailable, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt == 0 {
+			retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+			if err != nil || retryAfter <= 0 {
+				retryAfter = 2
+			}
+			log.Printf("Rate limited by %s, retrying in %ds", c.baseURL, retryAfter)
+			c.sleep(time.Duration(retryAfter) * time.Second)
+			continue
+		}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+			return nil, fmt.Errorf("%w: range %s: %s", errHibpUnavailable, prefix, resp.Status)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("range %s: %s", prefix, resp.Status)
+		}
+		return body, nil
+	}
+}
+
+// breachCheck is the result of the last check of the passwords, the hibp job stores its progress
+// while it runs and the breached passwords report only shows it
+type breachCheck struct {
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// Total is the number of logins with a password
+	Total       int                     `json:"total"`
+	Results     map[string]breachResult `json:"results"`
+	Undecrypted int                     `json:"undecrypted"`
+	Failed      int                     `json:"failed"`
+	// Error stopped the check before all passwords were checked
+	Error string `json:"error,omitempty"`
+}
+
+// breachResult is the count of a login, it's outdated once the item was changed
+type breachResult struct {
+	Count    int       `json:"count"`
+	Revision time.Time `json:"revision"`
+}
+
+// loadBreachCheck reads the encrypted result of the last check, an empty one is returned if none ran yet
+func loadBreachCheck() (breachCheck, error) {
+	check := breachCheck{Results: map[string]breachResult{}}
+	if !wf.Data.Exists(HIBP_RESULTS_NAME) {
+		return check, nil
+	}
+	data, err := wf.Data.Load(HIBP_RESULTS_NAME)
+	if err != nil {
+		return check, err
+	}
+	decrypted, err := decryptWithKey(hibpKeyName, data)
+	if err != nil {
+		return check, err
+	}
+	err = json.Unmarshal(decrypted, &check)
+	return check, err
+}
+
+func (c breachCheck) save() error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	encrypted, err := encryptWithKey(hibpKeyName, data)
+	if err != nil {
+		return err
+	}
+	return wf.Data.Store(HIBP_RESULTS_NAME, encrypted)
+}
+
+// add looks up the password of the item, it returns true if the check has to stop
+func (c *breachCheck) add(item Item, password string, count func(string) (int, error)) bool {
+	n, err := count(password)
+	if errors.Is(err, errHibpUnavailable) {
+		c.Error = err.Error()
+		return true
+	}
+	if err != nil {
+		log.Printf("Couldn't check the password of %s: %s", item.Id, err)
+		c.Failed++
+		return false
+	}
+	c.Results[item.Id] = breachResult{Count: n, Revision: item.RevisionDate}
+	return false
+}
+
+// breached returns the logins whose password was seen in breaches, the most common first,
+// and the number of logins which weren't checked yet or changed since
+func (c breachCheck) breached(items []Item) ([]breachedPassword, int) {
+	var breached []breachedPassword
+	unchecked := 0
+	for _, item := range items {
+		if item.Type != 1 || item.Login.Password == "" {
+			continue
+		}
+		result, ok := c.Results[item.Id]
+		if !ok || !result.Revision.Equal(item.RevisionDate) {
+			unchecked++
+			continue
+		}
+		if result.Count > 0 {
+			breached = append(breached, breachedPassword{Item: item, Count: result.Count})
+		}
+	}
+	sort.SliceStable(breached, func(i, j int) bool {
+		return breached[i].Count > breached[j].Count
+	})
+	return breached, unchecked
+}
+
+// startBreachCheck checks the passwords in the background, unless the check is running already
+func startBreachCheck() {
+	if wf.IsRunning("hibp") {
+		log.Printf("Breach check job already running.")
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-hibp")
+	if err := wf.RunInBackground("hibp", cmd); err != nil {
+		log.Printf("Couldn't start the breach check, error: %s", err)
+	}
+}
+
+// runBreachCheck checks all passwords against Have I Been Pwned, with -background it starts the
+// job and opens the report again
+func runBreachCheck() {
+	if opts.Background {
+		startBreachCheck()
+		searchAlfred(fmt.Sprintf("%s breached ", conf.BwreportKeyword))
+		return
+	}
+
+	check := breachCheck{Started: time.Now(), Results: map[string]breachResult{}}
+	finish := func() {
+		check.Finished = time.Now()
+		if err := check.save(); err != nil {
+			log.Printf("Couldn't store the breach check, error: %s", err)
+		}
+	}
+	items, err := loadCachedItems()
+	if err != nil {
+		check.Error = err.Error()
+		finish()
+		return
+	}
+	reader, err := newVaultReader()
+	if err != nil {
+		check.Error = err.Error()
+		finish()
+		return
+	}
+	for _, item := range items {
+		if item.Type == 1 && item.Login.Password != "" {
+			check.Total++
+		}
+	}
+	if err := check.save(); err != nil {
+		log.Println(err)
+	}
+
+	client := newPwnedClient()
+	processed := 0
+	check.Undecrypted = forEachPasswordUntil(items, reader, func(item Item, password string) bool {
+		stopped := check.add(item, password, client.count)
+		processed++
+		if !stopped && processed%breachCheckSaveEvery == 0 {
+			if err := check.save(); err != nil {
+				log.Println(err)
+			}
+		}
+		return stopped
+	})
+	finish()
+	log.Printf("Checked %d of %d passwords, %d failed", len(check.Results), check.Total, check.Failed)
+}
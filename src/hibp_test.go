@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_pwnedClient(t *testing.T) {
+	sum := sha1.Sum([]byte("password"))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+	rangeBody := fmt.Sprintf("0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n%s:3861493\r\n00D4F6E8FA6EECAD2A3AA415EEC418D38EC:0\r\n", suffix)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Add-Padding") != "true" {
+			t.Error("missing Add-Padding header")
+		}
+		if r.URL.Path != "/range/"+prefix {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, rangeBody)
+	}))
+	defer server.Close()
+
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	var slept time.Duration
+	newClient := func() *pwnedClient {
+		return &pwnedClient{
+			baseURL:  server.URL,
+			interval: 100 * time.Millisecond,
+			client:   server.Client(),
+			ranges:   map[string][]byte{},
+			now:      func() time.Time { return now },
+			sleep:    func(d time.Duration) { slept += d },
+		}
+	}
+
+	client := newClient()
+	if count, err := client.count("password"); err != nil || count != 3861493 {
+		t.Fatalf("count() = %d, %v, want 3861493", count, err)
+	}
+	// the second request of the same prefix is answered from memory
+	if _, err := client.count("password"); err != nil || requests != 1 {
+		t.Errorf("requests = %d, %v, want 1", requests, err)
+	}
+
+	t.Run("ranges are only kept in memory", func(t *testing.T) {
+		if _, err := newClient().count("password"); err != nil || requests != 2 {
+			t.Errorf("requests = %d, %v, want 2", requests, err)
+		}
+	})
+
+	t.Run("requests wait for the interval", func(t *testing.T) {
+		slept = 0
+		limited := newClient()
+		limited.lastRequest = now.Add(-40 * time.Millisecond)
+		if _, err := limited.count("password"); err != nil || slept != 60*time.Millisecond {
+			t.Errorf("slept = %s, %v, want 60ms", slept, err)
+		}
+	})
+
+	t.Run("unknown password and errors", func(t *testing.T) {
+		if count, err := client.count("correct horse battery staple"); err == nil || errors.Is(err, errHibpUnavailable) || count != 0 {
+			t.Errorf("count() = %d, %v, want the 404 error", count, err)
+		}
+		offline := newClient()
+		offline.baseURL = "http://127.0.0.1:1"
+		if _, err := offline.count("password"); !errors.Is(err, errHibpUnavailable) {
+			t.Errorf("count() error = %v, want errHibpUnavailable", err)
+		}
+	})
+
+	t.Run("mirror replaces the API", func(t *testing.T) {
+		mirror := t.TempDir()
+		if err := os.WriteFile(filepath.Join(mirror, prefix+".txt"), []byte(fmt.Sprintf("%s:42\n", suffix)), 0600); err != nil {
+			t.Fatal(err)
+		}
+		mirrored := newClient()
+		mirrored.mirror = mirror
+		before := requests
+		if count, err := mirrored.count("password"); err != nil || count != 42 || requests != before {
+			t.Errorf("count() = %d, %v with %d requests, want 42 from the mirror", count, err, requests-before)
+		}
+	})
+}
+
+func Test_breachCheck(t *testing.T) {
+	revision := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	items := []Item{
+		{Id: "a", Type: 1, RevisionDate: revision, Login: Login{Password: "encrypted"}},
+		{Id: "b", Type: 1, RevisionDate: revision, Login: Login{Password: "encrypted"}},
+		{Id: "c", Type: 1, RevisionDate: revision, Login: Login{Password: "encrypted"}},
+		{Id: "d", Type: 1, RevisionDate: revision, Login: Login{Password: "encrypted"}},
+		{Id: "note", Type: 2},
+	}
+	counts := map[string]int{"password": 10, "123456": 20, "kQ9#vLm2$xPz7!Rw": 0}
+	lookups := 0
+	count := func(password string) (int, error) {
+		lookups++
+		switch password {
+		case "broken":
+			return 0, errors.New("range 12345: 404 Not Found")
+		case "offline":
+			return 0, fmt.Errorf("%w: connection refused", errHibpUnavailable)
+		}
+		return counts[password], nil
+	}
+
+	check := breachCheck{Results: map[string]breachResult{}}
+	for i, password := range []string{"password", "broken", "123456"} {
+		if check.add(items[i], password, count) {
+			t.Fatalf("add(%s) stopped the check", password)
+		}
+	}
+	if !check.add(items[3], "offline", count) || check.Error == "" {
+		t.Errorf("add() didn't stop at the unavailable API, error %q", check.Error)
+	}
+	if check.Failed != 1 || lookups != 4 {
+		t.Errorf("Failed = %d with %d lookups, want 1 with 4", check.Failed, lookups)
+	}
+
+	// "d" wasn't checked and "c" changed since
+	items[2].RevisionDate = revision.Add(time.Hour)
+	breached, unchecked := check.breached(items)
+	if len(breached) != 1 || breached[0].Item.Id != "a" || breached[0].Count != 10 {
+		t.Errorf("breached() = %+v, want only a", breached)
+	}
+	if unchecked != 3 {
+		t.Errorf("breached() unchecked = %d, want 3", unchecked)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cards expiring within this time are reported
+const cardExpiryWarning = 60 * day
+
+// hygieneSection is a class of problems of the hygiene report, in the order they are shown
+type hygieneSection struct {
+	Name  string
+	Title string
+}
+
+var hygieneSections = []hygieneSection{
+	{Name: "insecure", Title: "Insecure http:// URLs"},
+	{Name: "duplicates", Title: "Duplicates"},
+	{Name: "nopassword", Title: "Logins without password"},
+	{Name: "nourl", Title: "Logins without URL"},
+	{Name: "untitled", Title: "Untitled items"},
+	{Name: "cards", Title: "Expired or expiring cards"},
+}
+
+// names given by Bitwarden or other password managers when none is entered
+var defaultItemNames = map[string]bool{
+	"":         true,
+	"untitled": true,
+	"new item": true,
+	"no name":  true,
+	"unnamed":  true,
+}
+
+// hygieneFinding is an item with a problem and the detail shown in the subtitle
+type hygieneFinding struct {
+	Item   Item
+	Detail string
+}
+
+// hygieneFindings returns the findings per section name
+func hygieneFindings(items []Item, now time.Time) map[string][]hygieneFinding {
+	findings := map[string][]hygieneFinding{}
+	add := func(section string, item Item, detail string) {
+		findings[section] = append(findings[section], hygieneFinding{Item: item, Detail: detail})
+	}
+
+	duplicates := map[string][]Item{}
+	var duplicateKeys []string
+	for _, item := range items {
+		if defaultItemNames[strings.ToLower(strings.TrimSpace(item.Name))] {
+			add("untitled", item, fmt.Sprintf("%s without a name", typeName(item.Type)))
+		}
+		if item.Type == 3 {
+			if expiry, ok := cardExpiry(item.Card); ok && expiry.Sub(now) < cardExpiryWarning {
+				detail := fmt.Sprintf("Expires %s/%s", item.Card.ExpMonth, item.Card.ExpYear)
+				if !expiry.After(now) {
+					detail = fmt.Sprintf("Expired %s/%s", item.Card.ExpMonth, item.Card.ExpYear)
+				}
+				add("cards", item, detail)
+			}
+		}
+		if item.Type != 1 {
+			continue
+		}
+		if item.Login.Password == "" {
+			add("nopassword", item, "No password")
+		}
+		if len(item.Login.Uris) == 0 {
+			add("nourl", item, "No URL")
+		}
+
+		hosts := map[string]bool{}
+		for _, uri := range item.Login.Uris {
+			if strings.HasPrefix(strings.ToLower(uri.Uri), "http://") {
+				add("insecure", item, uri.Uri)
+				break
+			}
+		}
+		for _, uri := range item.Login.Uris {
+			host := normalizedHost(uri.Uri)
+			if host == "" || hosts[host] {
+				continue
+			}
+			hosts[host] = true
+			key := fmt.Sprintf("%s · %s", host, strings.ToLower(item.Login.Username))
+			if _, ok := duplicates[key]; !ok {
+				duplicateKeys = append(duplicateKeys, key)
+			}
+			duplicates[key] = append(duplicates[key], item)
+		}
+	}
+
+	// logins sharing several hosts are listed once, with the first shared host and all their duplicates
+	var duplicated []Item
+	firstKeys := map[string]string{}
+	others := map[string][]Item{}
+	pairs := map[[2]string]bool{}
+	for _, key := range duplicateKeys {
+		group := duplicates[key]
+		if len(group) < 2 {
+			continue
+		}
+		for _, item := range group {
+			if _, ok := firstKeys[item.Id]; !ok {
+				firstKeys[item.Id] = key
+				duplicated = append(duplicated, item)
+			}
+			for _, other := range group {
+				pair := [2]string{item.Id, other.Id}
+				if other.Id == item.Id || pairs[pair] {
+					continue
+				}
+				pairs[pair] = true
+				others[item.Id] = append(others[item.Id], other)
+			}
+		}
+	}
+	for _, item := range duplicated {
+		add("duplicates", item, fmt.Sprintf("Same as %s (%s)", itemNames(others[item.Id]), firstKeys[item.Id]))
+	}
+	return findings
+}
+
+// normalizedHost is the lowercased host of the url without "www.", apps and other schemes without host are ignored
+func normalizedHost(uri string) string {
+	lower := strings.ToLower(uri)
+	if strings.Contains(lower, "://") && !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+		return ""
+	}
+	host := strings.ToLower(uriHost(uri))
+	if strings.Contains(host, "/") {
+		return ""
+	}
+	return strings.TrimPrefix(host, "www.")
+}
+
+// cardExpiry returns the end of the expiry month of the card, a card is valid until the month has passed
+func cardExpiry(card CardInfo) (time.Time, bool) {
+	month, err := strconv.Atoi(strings.TrimSpace(card.ExpMonth))
+	if err != nil || month < 1 || month > 12 {
+		return time.Time{}, false
+	}
+	year, err := strconv.Atoi(strings.TrimSpace(card.ExpYear))
+	if err != nil {
+		return time.Time{}, false
+	}
+	if year < 100 {
+		year += 2000
+	}
+	return time.Date(year, time.Month(month)+1, 1, 0, 0, 0, 0, time.Local), true
+}
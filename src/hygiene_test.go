@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_hygieneFindings(t *testing.T) {
+	now := time.Date(2022, 6, 15, 12, 0, 0, 0, time.Local)
+	login := func(id string, name string, username string, password string, uris ...string) Item {
+		item := Item{Id: id, Name: name, Type: 1, Login: Login{Username: username, Password: password}}
+		for _, uri := range uris {
+			item.Login.Uris = append(item.Login.Uris, Uri{Uri: uri})
+		}
+		return item
+	}
+	card := func(id string, month string, year string) Item {
+		return Item{Id: id, Name: id, Type: 3, Card: CardInfo{ExpMonth: month, ExpYear: year}}
+	}
+	items := []Item{
+		login("http", "Router", "admin", "hidden", "http://192.168.1.1"),
+		login("dup1", "Example", "Alice", "hidden", "https://www.example.com/login", "https://shop.example.net"),
+		login("dup2", "Example old", "alice", "hidden", "example.com", "shop.example.net"),
+		login("dup3", "Example Shop", "alice", "hidden", "https://shop.example.net/cart"),
+		login("other-user", "Example Bob", "bob", "hidden", "https://example.com"),
+		login("nopass", "No Password", "carol", "", "https://nopass.example"),
+		login("nourl", "No URL", "dave", "hidden"),
+		login("untitled", "Untitled", "erin", "hidden", "androidapp://com.example"),
+		{Id: "noname", Type: 2},
+		card("expired", "5", "2022"),
+		card("expiring", "07", "22"),
+		card("valid", "12", "2030"),
+		card("unknown", "", ""),
+	}
+
+	findings := hygieneFindings(items, now)
+	want := map[string][]string{
+		"insecure":   {"http"},
+		"duplicates": {"dup1", "dup2", "dup3"},
+		"nopassword": {"nopass"},
+		"nourl":      {"nourl"},
+		"untitled":   {"untitled", "noname"},
+		"cards":      {"expired", "expiring"},
+	}
+	for _, section := range hygieneSections {
+		var got []string
+		for _, finding := range findings[section.Name] {
+			got = append(got, finding.Item.Id)
+		}
+		if !reflect.DeepEqual(got, want[section.Name]) {
+			t.Errorf("%s = %v, want %v", section.Name, got, want[section.Name])
+		}
+	}
+
+	if detail := findings["cards"][0].Detail; detail != "Expired 5/2022" {
+		t.Errorf("expired card detail = %q", detail)
+	}
+	// the logins sharing two hosts are listed once
+	wantDetails := []string{
+		"Same as Example old, Example Shop (example.com · alice)",
+		"Same as Example, Example Shop (example.com · alice)",
+		"Same as Example, Example old (shop.example.net · alice)",
+	}
+	var details []string
+	for _, finding := range findings["duplicates"] {
+		details = append(details, finding.Detail)
+	}
+	if !reflect.DeepEqual(details, wantDetails) {
+		t.Errorf("duplicate details = %q, want %q", details, wantDetails)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+var errInvalidIco = errors.New("invalid ICO file")
+
+var pngMagic = []byte("\x89PNG\r\n\x1a\n")
+
+// icoEntry is an image of the directory of an ICO file
+type icoEntry struct {
+	Width  int
+	Height int
+	Bits   int
+	Data   []byte
+}
+
+// decodeIco returns the largest image of an ICO file, the images are either PNG files or bitmaps without file header
+func decodeIco(data []byte) (image.Image, error) {
+	if len(data) < 6 || binary.LittleEndian.Uint16(data[0:]) != 0 || binary.LittleEndian.Uint16(data[2:]) != 1 {
+		return nil, errInvalidIco
+	}
+	count := int(binary.LittleEndian.Uint16(data[4:]))
+	if count == 0 || len(data) < 6+16*count {
+		return nil, errInvalidIco
+	}
+
+	var best icoEntry
+	for i := 0; i < count; i++ {
+		dir := data[6+16*i:]
+		entry := icoEntry{Width: int(dir[0]), Height: int(dir[1]), Bits: int(binary.LittleEndian.Uint16(dir[6:]))}
+		// a size of 0 means 256 pixels
+		if entry.Width == 0 {
+			entry.Width = 256
+		}
+		if entry.Height == 0 {
+			entry.Height = 256
+		}
+		size, offset := int(binary.LittleEndian.Uint32(dir[8:])), int(binary.LittleEndian.Uint32(dir[12:]))
+		if offset < 0 || size <= 0 || offset+size > len(data) {
+			return nil, fmt.Errorf("%w, entry %d is out of bounds", errInvalidIco, i)
+		}
+		entry.Data = data[offset : offset+size]
+		if entry.Width*entry.Height > best.Width*best.Height ||
+			(entry.Width*entry.Height == best.Width*best.Height && entry.Bits > best.Bits) {
+			best = entry
+		}
+	}
+
+	if bytes.HasPrefix(best.Data, pngMagic) {
+		return png.Decode(bytes.NewReader(best.Data))
+	}
+	return decodeIcoBitmap(best.Data)
+}
+
+// decodeIcoBitmap decodes a bitmap of an ICO file, its height counts the color rows and the rows of the
+// transparency mask following them, both are stored bottom-up
+func decodeIcoBitmap(data []byte) (image.Image, error) {
+	if len(data) < 40 {
+		return nil, fmt.Errorf("%w, bitmap header too short", errInvalidIco)
+	}
+	headerSize := int(binary.LittleEndian.Uint32(data[0:]))
+	width := int(int32(binary.LittleEndian.Uint32(data[4:])))
+	height := int(int32(binary.LittleEndian.Uint32(data[8:]))) / 2
+	bits := int(binary.LittleEndian.Uint16(data[14:]))
+	compression := binary.LittleEndian.Uint32(data[16:])
+	colorsUsed := int(binary.LittleEndian.Uint32(data[32:]))
+	if headerSize < 40 || headerSize > len(data) || width <= 0 || height <= 0 || width > 256 || height > 256 || compression != 0 {
+		return nil, fmt.Errorf("%w, unsupported bitmap", errInvalidIco)
+	}
+
+	var palette color.Palette
+	offset := headerSize
+	switch bits {
+	case 1, 4, 8:
+		if colorsUsed == 0 || colorsUsed > 1<<bits {
+			colorsUsed = 1 << bits
+		}
+		if offset+4*colorsUsed > len(data) {
+			return nil, fmt.Errorf("%w, palette out of bounds", errInvalidIco)
+		}
+		for i := 0; i < colorsUsed; i++ {
+			c := data[offset+4*i:]
+			palette = append(palette, color.NRGBA{R: c[2], G: c[1], B: c[0], A: 0xff})
+		}
+		offset += 4 * colorsUsed
+	case 24, 32:
+	default:
+		return nil, fmt.Errorf("%w, unsupported bit depth %d", errInvalidIco, bits)
+	}
+
+	// rows are padded to 4 bytes
+	stride := (width*bits + 31) / 32 * 4
+	maskStride := (width + 31) / 32 * 4
+	pixels := data[offset:]
+	hasMask := len(pixels) >= stride*height+maskStride*height
+	if len(pixels) < stride*height {
+		return nil, fmt.Errorf("%w, bitmap data too short", errInvalidIco)
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		row := pixels[(height-1-y)*stride:]
+		for x := 0; x < width; x++ {
+			var c color.NRGBA
+			switch bits {
+			case 32:
+				c = color.NRGBA{R: row[4*x+2], G: row[4*x+1], B: row[4*x], A: row[4*x+3]}
+			case 24:
+				c = color.NRGBA{R: row[3*x+2], G: row[3*x+1], B: row[3*x], A: 0xff}
+			default:
+				pixelsPerByte := 8 / bits
+				shift := uint(8 - bits - (x%pixelsPerByte)*bits)
+				index := int(row[x/pixelsPerByte]>>shift) & (1<<bits - 1)
+				if index < len(palette) {
+					c = palette[index].(color.NRGBA)
+				}
+			}
+			// bitmaps without alpha channel are transparent where the bit of the mask is set
+			if bits != 32 && hasMask {
+				mask := pixels[stride*height+(height-1-y)*maskStride:]
+				if mask[x/8]&(0x80>>uint(x%8)) != 0 {
+					c.A = 0
+				}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img, nil
+}
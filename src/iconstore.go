@@ -0,0 +1,278 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jpillora/go-tld"
+)
+
+// Icons are stored once per domain as urlicon/<domain>.png, all logins of a site share it.
+// The icon index maps the item ids to the domains of their URLs. The icons of the items are resolved
+// when the cache is built and after the icons job, so the search neither parses URLs nor checks files.
+
+// iconIndex maps the item ids to the domains of their URLs, in the order of the URLs
+type iconIndex map[string][]string
+
+// iconDir is the folder of the downloaded icons
+func iconDir() string {
+	return filepath.Join(wf.DataDir(), "urlicon")
+}
+
+// iconDomain returns the domain the icon of the URL is stored under: the registrable domain,
+// or the host for IP addresses and local names. Apps and other schemes have no icon.
+func iconDomain(uri string) string {
+	lower := strings.ToLower(strings.TrimSpace(uri))
+	if strings.Contains(lower, "://") && !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+		return ""
+	}
+	if !strings.Contains(lower, "://") {
+		lower = fmt.Sprintf("http://%s", lower)
+	}
+	u, err := url.Parse(lower)
+	if err != nil {
+		return ""
+	}
+	domain := u.Hostname()
+	if net.ParseIP(domain) == nil {
+		if parsed, err := tld.Parse(lower); err == nil && parsed.Domain != "" {
+			domain = fmt.Sprintf("%s.%s", parsed.Domain, parsed.TLD)
+		}
+	}
+	// the domain is used as file name
+	if domain == "" || strings.Trim(domain, "abcdefghijklmnopqrstuvwxyz0123456789.-") != "" || strings.HasPrefix(domain, ".") {
+		return ""
+	}
+	return domain
+}
+
+// iconOrigin is the scheme and host of the URL the icon is downloaded from, paths and queries
+// of the logins aren't needed and aren't stored in the icon queue
+func iconOrigin(uri string) string {
+	origin := strings.TrimSpace(uri)
+	if !strings.Contains(origin, "://") {
+		origin = fmt.Sprintf("http://%s", origin)
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s://%s", strings.ToLower(u.Scheme), u.Host)
+}
+
+// itemIconDomains returns the distinct domains of the URLs of the login, with the origin of a URL of each to download the icon from
+func itemIconDomains(item Item) (domains []string, urls map[string]string) {
+	urls = map[string]string{}
+	if item.Type != 1 {
+		return nil, urls
+	}
+	for _, uri := range item.Login.Uris {
+		domain := iconDomain(uri.Uri)
+		origin := iconOrigin(uri.Uri)
+		if domain == "" || origin == "" {
+			continue
+		}
+		if _, ok := urls[domain]; !ok {
+			domains = append(domains, domain)
+			urls[domain] = origin
+		}
+	}
+	return domains, urls
+}
+
+// buildIconIndex returns the index of the items and the URL to download each domain's icon from
+func buildIconIndex(items []Item) (iconIndex, map[string]string) {
+	index := iconIndex{}
+	urls := map[string]string{}
+	for _, item := range items {
+		domains, itemUrls := itemIconDomains(item)
+		if len(domains) == 0 {
+			continue
+		}
+		index[item.Id] = domains
+		for domain, uri := range itemUrls {
+			if _, ok := urls[domain]; !ok {
+				urls[domain] = uri
+			}
+		}
+	}
+	return index, urls
+}
+
+// loadIconIndex reads the index written by the last sync
+func loadIconIndex() iconIndex {
+	index := iconIndex{}
+	if wf.Data.Exists(ICON_INDEX_NAME) {
+		if err := wf.Data.LoadJSON(ICON_INDEX_NAME, &index); err != nil {
+			log.Printf("Couldn't load the icon index, error: %s", err)
+		}
+	}
+	return index
+}
+
+// iconPath returns the icon of the first domain of the item which was downloaded,
+// the domains are taken from the index if it has the item
+func iconPath(dir string, index iconIndex, item Item) (string, bool) {
+	domains, ok := index[item.Id]
+	if !ok {
+		domains, _ = itemIconDomains(item)
+	}
+	for _, domain := range domains {
+		path := filepath.Join(dir, fmt.Sprintf("%s.png", domain))
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// itemIcon is the resolved icon of an item, the search only looks it up
+type itemIcon struct {
+	Favicon  string `json:"favicon,omitempty"`
+	Monogram string `json:"monogram,omitempty"`
+}
+
+// resolveItemIcons finds the downloaded favicon of the items and renders the monograms of the others
+func resolveItemIcons(items []Item, index iconIndex, dir string, monograms bool) map[string]itemIcon {
+	resolved := map[string]itemIcon{}
+	for _, item := range items {
+		var icon itemIcon
+		if path, ok := iconPath(dir, index, item); ok {
+			icon.Favicon = path
+		} else if monograms {
+			path, err := monogramPath(filepath.Join(dir, "monograms"), monogramText(item.Name), monogramColor(monogramColorKey(item, index)))
+			if err != nil {
+				log.Printf("Couldn't create the monogram of %s, error: %s", item.Name, err)
+			} else {
+				icon.Monogram = path
+			}
+		}
+		if icon != (itemIcon{}) {
+			resolved[item.Id] = icon
+		}
+	}
+	return resolved
+}
+
+// storeItemIcons resolves the icons of the items for the search
+func storeItemIcons(items []Item, index iconIndex) {
+	resolved := resolveItemIcons(items, index, iconDir(), conf.MonogramIcons)
+	if err := wf.Data.StoreJSON(ICON_PATHS_NAME, resolved); err != nil {
+		log.Println(err)
+	}
+}
+
+// refreshItemIcons resolves the icons of the cached items again, e.g. after new icons were downloaded
+func refreshItemIcons() {
+	items, err := loadCachedItems()
+	if err != nil {
+		log.Printf("Couldn't load the items cache, error: %s", err)
+		return
+	}
+	storeItemIcons(items, loadIconIndex())
+}
+
+// loadItemIcons reads the icons resolved by the last sync or icons job
+func loadItemIcons() map[string]itemIcon {
+	resolved := map[string]itemIcon{}
+	if wf.Data.Exists(ICON_PATHS_NAME) {
+		if err := wf.Data.LoadJSON(ICON_PATHS_NAME, &resolved); err != nil {
+			log.Printf("Couldn't load the item icons, error: %s", err)
+		}
+	}
+	return resolved
+}
+
+// missingIcons returns the URLs of the domains whose icon wasn't downloaded yet
+func missingIcons(dir string, urls map[string]string) map[string]string {
+	missing := map[string]string{}
+	for domain, uri := range urls {
+		if _, err := os.Stat(filepath.Join(dir, fmt.Sprintf("%s.png", domain))); os.IsNotExist(err) {
+			missing[domain] = uri
+		}
+	}
+	return missing
+}
+
+// collectIconGarbage removes the icons of domains no item uses anymore and the icons of older versions
+// stored by item id, it returns the number of removed files
+func collectIconGarbage(dir string, index iconIndex) (int, error) {
+	used := map[string]bool{}
+	for _, domains := range index {
+		for _, domain := range domains {
+			used[fmt.Sprintf("%s.png", domain)] = true
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, entry := range entries {
+		// unfinished downloads are left to the running icons job
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".png") || used[entry.Name()] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			log.Println(err)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// clearIconIndex removes the index, the resolved icons of the items and the queued icons on lock and logout, they show
+// the domains of every item. The icons are kept, their names only show which domains are used at all.
+func clearIconIndex() error {
+	for _, name := range []string{ICON_INDEX_NAME, ICON_PATHS_NAME, ICON_QUEUE_NAME} {
+		if err := wf.Data.StoreJSON(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateIconIndex stores the index of the cached items, removes the icons nobody uses anymore, resolves
+// the icons of the items and queues the icons of the new domains. Without a previous index all missing icons are queued.
+func updateIconIndex(items []Item, newDomains map[string]string) {
+	firstIndex := !wf.Data.Exists(ICON_INDEX_NAME)
+	index, urls := buildIconIndex(items)
+	if err := wf.Data.StoreJSON(ICON_INDEX_NAME, index); err != nil {
+		log.Println(err)
+	}
+	removed, err := collectIconGarbage(iconDir(), index)
+	if err != nil {
+		log.Printf("Couldn't remove unused icons, error: %s", err)
+	}
+	if removed > 0 {
+		log.Printf("Removed %d unused icons", removed)
+	}
+	storeItemIcons(items, index)
+
+	if !conf.IconCacheEnabled {
+		return
+	}
+	if !firstIndex {
+		urls = newDomains
+	}
+	queue := missingIcons(iconDir(), urls)
+	if len(queue) == 0 {
+		return
+	}
+	if err := queueIcons(queue); err != nil {
+		log.Println(err)
+	}
+	getIcon(wf)
+}
@@ -7,27 +7,44 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
-	"strings"
 	"time"
 
 	aw "github.com/deanishe/awgo"
+	"github.com/jychri/tilde"
 )
 
-func checkIconExistance(item Item, autoFetchCache bool) *aw.Icon {
-	icon := iconLink
-	if len(item.Login.Uris) > 0 && conf.IconCacheEnabled {
-		iconPath := fmt.Sprintf("%s/%s/%s.png", wf.DataDir(), "urlicon", item.Id)
-		if _, err := os.Stat(iconPath); err != nil {
-			log.Println("Couldn't load the cached icon, error: ", err)
-			if autoFetchCache {
-				log.Println("Getting icons.")
-				runGetIcons(item.Login.Uris[0].Uri, item.Id)
-			}
-		}
-		icon = &aw.Icon{Value: iconPath}
+// itemIcons are the icons resolved by the last sync or icons job, they are loaded with the first icon shown
+var itemIcons map[string]itemIcon
+
+// checkIconExistance returns the favicon of a login, or the monogram of the item without one.
+// It only looks up the resolved icons, missing favicons are fetched by the icons job.
+func checkIconExistance(item Item) *aw.Icon {
+	if itemIcons == nil {
+		itemIcons = loadItemIcons()
+	}
+	icon := itemIcons[item.Id]
+	if icon.Favicon != "" && conf.IconCacheEnabled {
+		return &aw.Icon{Value: icon.Favicon}
+	}
+	if icon.Monogram != "" && conf.MonogramIcons {
+		return &aw.Icon{Value: icon.Monogram}
+	}
+	return typeIcon(item.Type)
+}
+
+// typeIcon is the generic icon of the item type
+func typeIcon(itemType int) *aw.Icon {
+	switch itemType {
+	case 2:
+		return iconNote
+	case 3:
+		return iconCreditCard
+	case 4:
+		return iconIdBatch
 	}
-	return icon
+	return iconLink
 }
 
 func addBackToNormalSearchItem() {
@@ -39,8 +56,10 @@ func addBackToNormalSearchItem() {
 		Var("notification", "")
 }
 
-func addItemDetails(item Item, autoFetchCache bool) {
+func addItemDetails(item Item, ctx searchContext) {
 	wf.Configure(aw.SuppressUIDs(true))
+	// values copied from the detail view count as usage of the item
+	wf.Var("itemid", item.Id)
 	addBackToNormalSearchItem()
 	wf.NewItem(fmt.Sprintf("Detail view for: %s", item.Name)).
 		Subtitle("").Valid(false).
@@ -53,12 +72,7 @@ func addItemDetails(item Item, autoFetchCache bool) {
 		Var("action", "output").Valid(true)
 	// item.OrganiztionId
 	if conf.EmptyDetailResults || item.OrganizationId != "" {
-		wf.NewItem("Organization Id").
-			Subtitle(fmt.Sprintf("%q", item.OrganizationId)).
-			Arg(item.OrganizationId).
-			Icon(iconOrg).
-			Var("notification", fmt.Sprintf("Copied Organization Id:\n%q", item.OrganizationId)).
-			Var("action", "output").Valid(true)
+		addNameDetail("Organization", item.OrganizationId, ctx.Organizations, iconOrg)
 	}
 	// item.FolderId
 	if conf.EmptyDetailResults || item.FolderId != "" {
@@ -129,25 +143,51 @@ func addItemDetails(item Item, autoFetchCache bool) {
 		for k, att := range item.Attachments {
 			counter := k + 1
 			// it's a secret type so we need to fetch the secret from Bitwarden
-			wf.NewItem(fmt.Sprintf("[Attachment %d] %s", counter, att.FileName)).
-				Subtitle(fmt.Sprintf("↩ or ⇥ save Attachment to %s, size %s", conf.OutputFolder, att.SizeName)).
+			it := wf.NewItem(fmt.Sprintf("[Attachment %d] %s", counter, att.FileName)).
+				Subtitle(fmt.Sprintf("↩ or ⇥ save Attachment to %s, ⌘ open, ⌃ delete, size %s", conf.OutputFolder, att.SizeName)).
 				Icon(iconPaperClip).
 				Valid(true).
 				Var("notification", fmt.Sprintf("Save attachment to :\n%s%s", conf.OutputFolder, att.FileName)).
 				Var("action", "-getitem").
 				Var("action2", fmt.Sprintf("-attachment %s", att.Id)).
 				Var("action3", fmt.Sprintf("-id %s", item.Id))
+			it.NewModifier("cmd").
+				Subtitle(fmt.Sprintf("Open Attachment, it's removed again after %d minutes", conf.AttachmentOpenTimeout)).
+				Icon(iconPaperClip).
+				Var("notification", fmt.Sprintf("Open attachment:\n%s", att.FileName)).
+				Var("action", "-openattachment").
+				Var("action2", fmt.Sprintf("-attachment %s", att.Id)).
+				Var("action3", fmt.Sprintf("-id %s", item.Id))
+			it.NewModifier("ctrl").
+				Subtitle("Delete Attachment").
+				Icon(aw.IconTrash).
+				Var("action", "-confirmdelete").
+				Var("action2", fmt.Sprintf("-attachment %s", att.Id)).
+				Var("action3", fmt.Sprintf("-id %s", item.Id))
+		}
+	}
+	// upload a new attachment from the file path in the query
+	if opts.Query != "" {
+		path := tilde.Abs(opts.Query)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			wf.NewItem(fmt.Sprintf("Upload Attachment %s", filepath.Base(path))).
+				Subtitle(fmt.Sprintf("↩ or ⇥ upload %s as attachment", path)).
+				Match(opts.Query).
+				Icon(iconPaperClip).
+				Valid(true).
+				Arg(path).
+				Var("notification", fmt.Sprintf("Upload attachment:\n%s", filepath.Base(path))).
+				Var("action", "-addattachment").
+				Var("action2", fmt.Sprintf("-id %s", item.Id)).
+				Var("action3", " ")
 		}
 	}
 	// item.CollectionIds
-	if conf.EmptyDetailResults || len(item.CollectionIds) > 0 {
-		wf.NewItem("Collection IDs").
-			Subtitle(fmt.Sprintf("%q", strings.Join(item.CollectionIds, ","))).
-			Arg(fmt.Sprintf("%q", strings.Join(item.CollectionIds, ","))).
-			Icon(iconBoxes).
-			Var("notification", fmt.Sprintf("Copied Collections IDs:\n%q", fmt.Sprintf("%q", strings.Join(item.CollectionIds, ",")))).
-			Var("action", "output").Valid(true)
-
+	if conf.EmptyDetailResults && len(item.CollectionIds) == 0 {
+		addNameDetail("Collection", "", ctx.Collections, iconBoxes)
+	}
+	for _, id := range item.CollectionIds {
+		addNameDetail("Collection", id, ctx.Collections, iconBoxes)
 	}
 	// item.RevisionDate
 	if conf.EmptyDetailResults || fmt.Sprint(item.RevisionDate) != "" {
@@ -162,7 +202,7 @@ func addItemDetails(item Item, autoFetchCache bool) {
 	// item.Type 1
 	if item.Type == 1 {
 		// get icons from cache
-		icon := checkIconExistance(item, autoFetchCache)
+		icon := checkIconExistance(item)
 
 		// item.Login.Username
 		if conf.EmptyDetailResults || item.Login.Username != "" {
@@ -445,7 +485,27 @@ func addItemDetails(item Item, autoFetchCache bool) {
 	}
 }
 
-func addItemsToWorkflow(item Item, autoFetchCache bool) {
+// addNameDetail shows the name for the id in the detail view, ⌘ copies the id instead
+func addNameDetail(title string, id string, names map[string]string, icon *aw.Icon) {
+	name := names[id]
+	if name == "" {
+		name = id
+	}
+	wf.NewItem(title).
+		Subtitle(fmt.Sprintf("%q, ⌘ copy id", name)).
+		Arg(name).
+		Icon(icon).
+		Var("notification", fmt.Sprintf("Copied %s:\n%q", title, name)).
+		Var("action", "output").Valid(true).
+		NewModifier("cmd").
+		Subtitle(fmt.Sprintf("Copy %s Id %q", title, id)).
+		Arg(id).
+		Var("notification", fmt.Sprintf("Copied %s Id:\n%q", title, id)).
+		Var("action", "output")
+}
+
+// addItemsToWorkflow adds the item, the note is shown in front of the subtitle, e.g. which field matched the search
+func addItemsToWorkflow(item Item, note string) {
 	var template = map[string]modifierActionRelation{
 		"nomod": {}, "mod1": {}, "mod2": {}, "mod3": {}, "mod4": {},
 	}
@@ -453,10 +513,10 @@ func addItemsToWorkflow(item Item, autoFetchCache bool) {
 		"item1": template, "item2": template, "item3": template, "item4": template,
 	}
 
+	var it *aw.Item
+	// get icons from cache
+	icon := checkIconExistance(item)
 	if item.Type == 1 {
-		// get icons from cache
-		icon := checkIconExistance(item, autoFetchCache)
-
 		totpEmoji, err := getTypeEmoji("totp")
 		if err != nil {
 			log.Fatal(err.Error())
@@ -476,29 +536,38 @@ func addItemsToWorkflow(item Item, autoFetchCache bool) {
 
 		getModifierActionRelations(itemModSet, item, "item1", icon, totp, url)
 		debugLog(fmt.Sprintf("Item1:\n%+v", itemModSet["item1"]))
-		addNewItem(itemModSet["item1"], item.Name)
+		it = addNewItem(itemModSet["item1"], item.Name, item.Id, note)
 	} else if item.Type == 2 {
-		getModifierActionRelations(itemModSet, item, "item2", nil, "", "")
+		getModifierActionRelations(itemModSet, item, "item2", icon, "", "")
 		debugLog(fmt.Sprintf("Item2:\n%+v", itemModSet["item2"]))
-		addNewItem(itemModSet["item2"], item.Name)
+		it = addNewItem(itemModSet["item2"], item.Name, item.Id, note)
 	} else if item.Type == 3 {
-		getModifierActionRelations(itemModSet, item, "item3", nil, "", "")
+		getModifierActionRelations(itemModSet, item, "item3", icon, "", "")
 		debugLog(fmt.Sprintf("Item3:\n%+v", itemModSet["item3"]))
-		addNewItem(itemModSet["item3"], item.Name)
+		it = addNewItem(itemModSet["item3"], item.Name, item.Id, note)
 	} else if item.Type == 4 {
-		getModifierActionRelations(itemModSet, item, "item4", nil, "", "")
+		getModifierActionRelations(itemModSet, item, "item4", icon, "", "")
 		debugLog(fmt.Sprintf("Item4:\n%+v", itemModSet["item4"]))
-		addNewItem(itemModSet["item4"], item.Name)
+		it = addNewItem(itemModSet["item4"], item.Name, item.Id, note)
 	} else {
 		log.Printf("New item, needs to be implemented.")
+		return
 	}
+	// match on all indexed fields in case Alfred filters the results, not on the decorated title
+	it.Match(itemMatchText(item, conf.SearchFieldWeights))
 }
 
-func addNewItem(item map[string]modifierActionRelation, name string) *aw.Item {
+// addNewItem adds the item with its modifiers, the itemid variable is used to record the usage of copied values
+func addNewItem(item map[string]modifierActionRelation, name string, id string, note string) *aw.Item {
+	subtitle := item["nomod"].Content.Subtitle
+	if note != "" {
+		subtitle = fmt.Sprintf("%s · %s", note, subtitle)
+	}
 	it := wf.NewItem(item["nomod"].Content.Title).
-		Subtitle(item["nomod"].Content.Subtitle).Valid(true).
+		Subtitle(subtitle).Valid(true).
 		Arg(item["nomod"].Content.Arg).
 		UID(name).
+		Var("itemid", id).
 		Var("notification", item["nomod"].Content.Notification).
 		Var("action", item["nomod"].Content.Action).
 		Var("action2", item["nomod"].Content.Action2).
@@ -506,27 +575,28 @@ func addNewItem(item map[string]modifierActionRelation, name string) *aw.Item {
 		Arg(item["nomod"].Content.Arg).
 		Icon(item["nomod"].Content.Icon)
 	if item["mod1"].Keys != nil {
-		addNewModifierItem(it, item["mod1"])
+		addNewModifierItem(it, item["mod1"], id)
 	}
 	if item["mod2"].Keys != nil {
-		addNewModifierItem(it, item["mod2"])
+		addNewModifierItem(it, item["mod2"], id)
 	}
 	if item["mod3"].Keys != nil {
-		addNewModifierItem(it, item["mod3"])
+		addNewModifierItem(it, item["mod3"], id)
 	}
 	if item["mod4"].Keys != nil {
-		addNewModifierItem(it, item["mod4"])
+		addNewModifierItem(it, item["mod4"], id)
 	}
 	if item["mod5"].Keys != nil {
-		addNewModifierItem(it, item["mod5"])
+		addNewModifierItem(it, item["mod5"], id)
 	}
 	return it
 }
 
-func addNewModifierItem(item *aw.Item, modifier modifierActionRelation) {
+func addNewModifierItem(item *aw.Item, modifier modifierActionRelation, id string) {
 	item.NewModifier(modifier.Keys[0:]...).
 		Subtitle(modifier.Content.Subtitle).
 		Arg(modifier.Content.Arg).
+		Var("itemid", id).
 		Var("notification", modifier.Content.Notification).
 		Var("action", modifier.Content.Action).
 		Var("action2", modifier.Content.Action2).
@@ -20,16 +20,30 @@ import (
 )
 
 const (
-	issueTrackerURL   = "https://github.com/blacs30/bitwarden-alfred-workflow/issues"
-	forumThreadURL    = "https://www.alfredforum.com/topic/11705-bitwarden-cli-get-passwords-username-and-totp-from-bitwarden/"
-	repo              = "blacs30/bitwarden-alfred-workflow"
-	CACHE_NAME        = "bw-items"
-	ICON_CACHE_NAME   = "icon-items"
-	FOLDER_CACHE_NAME = "bw-items-folders"
-	WORKFLOW_NAME     = "bitwarden-alfred-workflow"
-	AUTO_FETCH_CACHE  = "auto-fetch"
-	LAST_USAGE_CACHE  = "last-usage"
-	SYNC_CACHE_NAME   = "sync-cache"
+	issueTrackerURL         = "https://github.com/blacs30/bitwarden-alfred-workflow/issues"
+	forumThreadURL          = "https://www.alfredforum.com/topic/11705-bitwarden-cli-get-passwords-username-and-totp-from-bitwarden/"
+	repo                    = "blacs30/bitwarden-alfred-workflow"
+	CACHE_NAME              = "bw-items"
+	ICON_CACHE_NAME         = "icon-items"
+	ICON_QUEUE_NAME         = "icon-queue"
+	ICON_INDEX_NAME         = "icon-index"
+	ICON_PATHS_NAME         = "icon-paths"
+	FOLDER_CACHE_NAME       = "bw-items-folders"
+	COLLECTION_CACHE_NAME   = "bw-items-collections"
+	ORGANIZATION_CACHE_NAME = "bw-items-organizations"
+	EXCLUDED_CACHE_NAME     = "bw-items-excluded"
+	WORKFLOW_NAME           = "bitwarden-alfred-workflow"
+	AUTO_FETCH_CACHE        = "auto-fetch"
+	LAST_USAGE_CACHE        = "last-usage"
+	SYNC_CACHE_NAME         = "sync-cache"
+	SYNC_BACKOFF_NAME       = "sync-backoff"
+	DAEMON_STATUS_NAME      = "daemon-status"
+	SEND_CACHE_NAME         = "bw-sends"
+	USAGE_HISTORY_NAME      = "usage-history"
+	HIBP_RESULTS_NAME       = "hibp-results"
+	SAVED_SEARCHES_NAME     = "saved-searches"
+	TWOFA_DIRECTORY_NAME    = "2fa-directory.json"
+	TWOFA_BACKOFF_NAME      = "2fa-directory-backoff"
 )
 
 var (
@@ -62,6 +76,7 @@ func init() {
 
 func checkRunningProcesses(processName string) error {
 	myPid := os.Getpid()
+	daemonPid := runningDaemonPid()
 	processList, err := ps.Processes()
 	if err != nil {
 		return err
@@ -72,7 +87,7 @@ func checkRunningProcesses(processName string) error {
 		process.Executable()
 		// See if there is another bitwarden process hanging which is not our own
 		// ...and kill that stale process
-		if process.Executable() == processName && process.Pid() != myPid {
+		if process.Executable() == processName && process.Pid() != myPid && process.Pid() != daemonPid {
 			log.Printf("Found stale process %d\t%s\n", process.Pid(), process.Executable())
 			err := killProcess(process.Pid())
 			if err != nil {
@@ -157,7 +172,8 @@ func run() {
 		}
 		wf.FatalError(err)
 	}
-	opts.Query = cli.Arg(0)
+	// the modifier actions pass a blank " " as placeholder query
+	opts.Query = strings.TrimSpace(cli.Arg(0))
 
 	log.Printf("%#v", opts)
 	if wf.Debug() {
@@ -165,6 +181,20 @@ func run() {
 		log.Print(spew.Sdump(conf))
 	}
 
+	// the daemon runs until it's stopped, it mustn't kill the other processes of the workflow
+	if opts.Daemon {
+		runDaemon()
+		return
+	}
+	if opts.InstallDaemon {
+		runInstallDaemon()
+		return
+	}
+	if opts.UninstallDaemon {
+		runUninstallDaemon()
+		return
+	}
+
 	exists := commandExists(conf.BwExec)
 	if !exists && !opts.Open {
 		wf.NewItem(fmt.Sprintf("Error the Bitwarden command %q wasn't found.", conf.BwExec)).
@@ -262,9 +292,104 @@ func run() {
 		return
 	}
 
+	if opts.Send {
+		runSend()
+		return
+	}
+
+	if opts.SendCreate {
+		runSendCreate()
+		return
+	}
+
+	if opts.SendDelete {
+		runSendDelete()
+		return
+	}
+
+	if opts.SendLink {
+		runSendLink()
+		return
+	}
+
+	if opts.SendReceive {
+		runSendReceive()
+		return
+	}
+
+	if opts.AddAttachment {
+		runAddAttachment()
+		return
+	}
+
+	if opts.ConfirmDelete {
+		runConfirmDeleteAttachment()
+		return
+	}
+
+	if opts.DeleteAttachment {
+		runDeleteAttachment()
+		return
+	}
+
+	if opts.OpenAttachment {
+		runOpenAttachment()
+		return
+	}
+
+	if opts.WipeAttachments {
+		runWipeAttachments()
+		return
+	}
+
+	if opts.Saved {
+		runSaved()
+		return
+	}
+
+	if opts.SaveSearch {
+		runSaveSearch()
+		return
+	}
+
+	if opts.DeleteSaved {
+		runDeleteSaved()
+		return
+	}
+
+	if opts.Usage {
+		runUsage()
+		return
+	}
+
+	if opts.ResetUsage {
+		runResetUsage()
+		return
+	}
+
+	if opts.Report {
+		runReport()
+		return
+	}
+
+	if opts.Rotate {
+		runRotate()
+		return
+	}
+
+	if opts.Hibp {
+		runBreachCheck()
+		return
+	}
+
+	if opts.TwofaDirectory {
+		runRefreshTwoFactorDirectory()
+		return
+	}
+
 	if opts.Icons {
 		log.Println("Start getting icons")
-		runGetIcons("", "")
+		runGetIcons("")
 		return
 	}
 
@@ -0,0 +1,146 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// monogramSize is the width and height of the monogram icons in pixels
+const monogramSize = 128
+
+// monogramColors are the background colors of the monograms, white text is readable on all of them
+var monogramColors = []color.NRGBA{
+	{R: 0xd3, G: 0x2f, B: 0x2f, A: 0xff}, // red
+	{R: 0xc2, G: 0x18, B: 0x5b, A: 0xff}, // pink
+	{R: 0x7b, G: 0x1f, B: 0xa2, A: 0xff}, // purple
+	{R: 0x51, G: 0x2d, B: 0xa8, A: 0xff}, // deep purple
+	{R: 0x30, G: 0x3f, B: 0x9f, A: 0xff}, // indigo
+	{R: 0x19, G: 0x76, B: 0xd2, A: 0xff}, // blue
+	{R: 0x00, G: 0x79, B: 0x6b, A: 0xff}, // teal
+	{R: 0x38, G: 0x8e, B: 0x3c, A: 0xff}, // green
+	{R: 0x68, G: 0x9f, B: 0x38, A: 0xff}, // light green
+	{R: 0xe6, G: 0x51, B: 0x00, A: 0xff}, // orange
+	{R: 0x5d, G: 0x40, B: 0x37, A: 0xff}, // brown
+	{R: 0x45, G: 0x5a, B: 0x64, A: 0xff}, // blue grey
+}
+
+var (
+	monogramFace     font.Face
+	monogramFaceErr  error
+	monogramFaceOnce sync.Once
+)
+
+// monogramText returns the initials of the first and last word of the name, e.g. "BA" for "Bank of America"
+func monogramText(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return "?"
+	}
+	initials := []rune(words[0])[:1]
+	if len(words) > 1 {
+		initials = append(initials, []rune(words[len(words)-1])[0])
+	}
+	return strings.ToUpper(string(initials))
+}
+
+// monogramColor returns the same background color for the same key
+func monogramColor(key string) color.NRGBA {
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(key)))
+	return monogramColors[h.Sum32()%uint32(len(monogramColors))]
+}
+
+// monogramColorKey is the domain of a login, or else the folder, so the items of a site or folder share a color
+func monogramColorKey(item Item, index iconIndex) string {
+	domains, ok := index[item.Id]
+	if !ok {
+		domains, _ = itemIconDomains(item)
+	}
+	if len(domains) > 0 {
+		return domains[0]
+	}
+	if item.FolderId != "" {
+		return item.FolderId
+	}
+	return item.Name
+}
+
+// renderMonogram draws the text in white on a circle of the color and returns it as PNG
+func renderMonogram(text string, background color.NRGBA) ([]byte, error) {
+	monogramFaceOnce.Do(func() {
+		var f *opentype.Font
+		f, monogramFaceErr = opentype.Parse(gobold.TTF)
+		if monogramFaceErr == nil {
+			monogramFace, monogramFaceErr = opentype.NewFace(f, &opentype.FaceOptions{Size: 56, DPI: 72, Hinting: font.HintingFull})
+		}
+	})
+	if monogramFaceErr != nil {
+		return nil, monogramFaceErr
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, monogramSize, monogramSize))
+	// the edge of the circle is antialiased by the coverage of each pixel
+	center, radius := float64(monogramSize)/2, float64(monogramSize)/2-2
+	for y := 0; y < monogramSize; y++ {
+		for x := 0; x < monogramSize; x++ {
+			distance := math.Hypot(float64(x)+0.5-center, float64(y)+0.5-center)
+			coverage := math.Max(0, math.Min(1, radius-distance+0.5))
+			if coverage > 0 {
+				c := background
+				c.A = uint8(coverage * float64(background.A))
+				img.SetNRGBA(x, y, c)
+			}
+		}
+	}
+
+	drawer := font.Drawer{Dst: img, Src: image.NewUniform(color.White), Face: monogramFace}
+	width := drawer.MeasureString(text)
+	capHeight := monogramFace.Metrics().CapHeight
+	drawer.Dot = fixed.Point26_6{
+		X: (fixed.I(monogramSize) - width) / 2,
+		Y: (fixed.I(monogramSize) + capHeight) / 2,
+	}
+	drawer.DrawString(text)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// monogramPath returns the cached monogram of the text and color, it's rendered the first time
+func monogramPath(dir string, text string, background color.NRGBA) (string, error) {
+	path := filepath.Join(dir, fmt.Sprintf("%s-%02x%02x%02x.png", text, background.R, background.G, background.B))
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	data, err := renderMonogram(text, background)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return path, writeIcon(path, data)
+}
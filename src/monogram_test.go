@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_monogramText(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "GitHub", want: "G"},
+		{name: "Bank of America", want: "BA"},
+		{name: "  amazon.de (private) ", want: "AP"},
+		{name: "über-bank", want: "ÜB"},
+		{name: "1Password", want: "1"},
+		{name: "---", want: "?"},
+		{name: "", want: "?"},
+	}
+	for _, tt := range tests {
+		if got := monogramText(tt.name); got != tt.want {
+			t.Errorf("monogramText(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func Test_monogramColor(t *testing.T) {
+	github := Item{Id: "a", Type: 1, Login: Login{Uris: []Uri{{Uri: "https://github.com/login"}}}}
+	gist := Item{Id: "b", Type: 1, FolderId: "work", Login: Login{Uris: []Uri{{Uri: "https://gist.github.com"}}}}
+	card := Item{Id: "c", Type: 3, FolderId: "work", Name: "Visa"}
+	note := Item{Id: "d", Type: 2, Name: "Wifi"}
+
+	if key := monogramColorKey(github, iconIndex{}); key != "github.com" {
+		t.Errorf("monogramColorKey() = %q, want the domain", key)
+	}
+	if key := monogramColorKey(gist, iconIndex{"b": {"example.com"}}); key != "example.com" {
+		t.Errorf("monogramColorKey() = %q, want the domain of the index", key)
+	}
+	if key := monogramColorKey(card, iconIndex{}); key != "work" {
+		t.Errorf("monogramColorKey() = %q, want the folder", key)
+	}
+	if key := monogramColorKey(note, iconIndex{}); key != "Wifi" {
+		t.Errorf("monogramColorKey() = %q, want the name", key)
+	}
+	if monogramColor("github.com") != monogramColor("GitHub.com") {
+		t.Error("monogramColor() differs for the same domain")
+	}
+	colors := map[color.NRGBA]bool{}
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		colors[monogramColor(key)] = true
+	}
+	if len(colors) < 3 {
+		t.Errorf("monogramColor() uses only %d colors for 8 keys", len(colors))
+	}
+}
+
+func Test_monogramPath(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "monograms")
+	background := monogramColors[0]
+	path, err := monogramPath(dir, "BA", background)
+	if err != nil {
+		t.Fatalf("monogramPath() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("monogram isn't a PNG: %v", err)
+	}
+	if size := img.Bounds().Size(); size.X != monogramSize || size.Y != monogramSize {
+		t.Errorf("monogram size = %v", size)
+	}
+	if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+		t.Error("the corner of the monogram isn't transparent")
+	}
+	if got := color.NRGBAModel.Convert(img.At(monogramSize/2, 8)); got != background {
+		t.Errorf("background = %v, want %v", got, background)
+	}
+	white := 0
+	for x := 0; x < monogramSize; x++ {
+		if r, g, b, _ := img.At(x, monogramSize/2).RGBA(); r == 0xffff && g == 0xffff && b == 0xffff {
+			white++
+		}
+	}
+	if white == 0 {
+		t.Error("the monogram has no text")
+	}
+
+	// the cached monogram is reused
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if again, err := monogramPath(dir, "BA", background); err != nil || again != path {
+		t.Errorf("monogramPath() = %q, %v, want %q", again, err, path)
+	}
+	if info, err := os.Stat(path); err != nil || !info.ModTime().Equal(old) {
+		t.Error("the cached monogram was rendered again")
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jpillora/go-tld"
+)
+
+// Qualifiers which can be mixed with the free text of a search, e.g.
+// "type:login folder:Work -folder:Archive has:totp github"
+var searchQualifierKeys = map[string]bool{
+	"type":       true,
+	"folder":     true,
+	"org":        true,
+	"collection": true,
+	"fav":        true,
+	"has":        true,
+	"url":        true,
+	"user":       true,
+}
+
+type searchQualifier struct {
+	Key    string
+	Value  string
+	Negate bool
+}
+
+type searchQuery struct {
+	Text       string
+	Qualifiers []searchQualifier
+}
+
+// searchContext maps the ids of an item to names, so that qualifiers can match names
+type searchContext struct {
+	Folders       map[string]string
+	Organizations map[string]string
+	Collections   map[string]string
+}
+
+func newSearchContext(folders []Folder, collections []Collection, organizations []Organization) searchContext {
+	ctx := searchContext{
+		Folders:       map[string]string{},
+		Organizations: map[string]string{},
+		Collections:   map[string]string{},
+	}
+	for _, folder := range folders {
+		ctx.Folders[folder.Id] = folder.Name
+	}
+	for _, collection := range collections {
+		ctx.Collections[collection.Id] = collection.Name
+	}
+	for _, organization := range organizations {
+		ctx.Organizations[organization.Id] = organization.Name
+	}
+	return ctx
+}
+
+// splitQueryWords splits the query at whitespace, double quotes group words,
+// e.g. `folder:"Work Stuff" aws` results in [folder:Work Stuff, aws]
+func splitQueryWords(query string) []string {
+	var words []string
+	var word strings.Builder
+	quoted := false
+	hasWord := false
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			hasWord = true
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if hasWord {
+				words = append(words, word.String())
+				word.Reset()
+				hasWord = false
+			}
+		default:
+			word.WriteRune(r)
+			hasWord = true
+		}
+	}
+	if hasWord {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// parseSearchQuery separates the qualifiers from the free text of the query
+func parseSearchQuery(query string) searchQuery {
+	var q searchQuery
+	var text []string
+	for _, word := range splitQueryWords(query) {
+		negate := strings.HasPrefix(word, "-")
+		key, value, found := strings.Cut(strings.TrimPrefix(word, "-"), ":")
+		key = strings.ToLower(key)
+		if !found || value == "" || !searchQualifierKeys[key] {
+			text = append(text, word)
+			continue
+		}
+		q.Qualifiers = append(q.Qualifiers, searchQualifier{Key: key, Value: value, Negate: negate})
+	}
+	q.Text = strings.Join(text, " ")
+	return q
+}
+
+func (q searchQuery) String() string {
+	var parts []string
+	for _, qualifier := range q.Qualifiers {
+		negate := ""
+		if qualifier.Negate {
+			negate = "-"
+		}
+		value := qualifier.Value
+		if strings.ContainsAny(value, " \t") {
+			value = fmt.Sprintf("%q", value)
+		}
+		parts = append(parts, fmt.Sprintf("%s%s:%s", negate, qualifier.Key, value))
+	}
+	if q.Text != "" {
+		parts = append(parts, q.Text)
+	}
+	return strings.Join(parts, " ")
+}
+
+// filterItems returns the items which match all qualifiers of the query
+func filterItems(items []Item, q searchQuery, ctx searchContext) []Item {
+	if len(q.Qualifiers) == 0 {
+		return items
+	}
+	var filtered []Item
+	for _, item := range items {
+		if q.matches(item, ctx) {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered
+}
+
+func (q searchQuery) matches(item Item, ctx searchContext) bool {
+	for _, qualifier := range q.Qualifiers {
+		if qualifier.matches(item, ctx) == qualifier.Negate {
+			return false
+		}
+	}
+	return true
+}
+
+func (qualifier searchQualifier) matches(item Item, ctx searchContext) bool {
+	value := strings.ToLower(qualifier.Value)
+	switch qualifier.Key {
+	case "type":
+		return item.Type == getItemTypeByName(value)
+	case "folder":
+		if value == "none" {
+			return item.FolderId == ""
+		}
+		return matchesNameOrId(item.FolderId, ctx.Folders, value)
+	case "org":
+		if value == "none" {
+			return item.OrganizationId == ""
+		}
+		return matchesNameOrId(item.OrganizationId, ctx.Organizations, value)
+	case "collection":
+		for _, id := range item.CollectionIds {
+			if matchesNameOrId(id, ctx.Collections, value) {
+				return true
+			}
+		}
+		return false
+	case "fav":
+		favorite, err := strconv.ParseBool(value)
+		if err != nil {
+			return false
+		}
+		return item.Favorite == favorite
+	case "has":
+		return itemHas(item, value)
+	case "url":
+		for _, uri := range item.Login.Uris {
+			if strings.Contains(strings.ToLower(uriHost(uri.Uri)), value) {
+				return true
+			}
+		}
+		return false
+	case "user":
+		return strings.Contains(strings.ToLower(item.Login.Username), value) ||
+			strings.Contains(strings.ToLower(item.Identity.Username), value)
+	}
+	return false
+}
+
+// matchesNameOrId matches the name case insensitive, a parent folder like "Work" matches "Work/Infra" as well
+func matchesNameOrId(id string, names map[string]string, value string) bool {
+	if id == "" {
+		return false
+	}
+	if strings.ToLower(id) == value {
+		return true
+	}
+	name := strings.ToLower(names[id])
+	return name == value || strings.HasPrefix(name, fmt.Sprintf("%s/", value))
+}
+
+func itemHas(item Item, value string) bool {
+	switch value {
+	case "totp":
+		return item.Login.Totp != ""
+	case "attachment", "attachments":
+		return len(item.Attachments) > 0
+	case "password":
+		return item.Login.Password != ""
+	case "url", "uri":
+		return len(item.Login.Uris) > 0
+	case "notes", "note":
+		return item.Notes != ""
+	case "fields", "field":
+		return len(item.Fields) > 0
+	}
+	return false
+}
+
+// uriHost returns the host of the uri, or the uri itself if it can't be parsed
+func uriHost(uri string) string {
+	if !strings.Contains(uri, "://") {
+		uri = fmt.Sprintf("http://%s", uri)
+	}
+	u, err := tld.Parse(uri)
+	if err != nil || u.Host == "" {
+		return uri
+	}
+	return u.Host
+}
+
+// registrableDomain returns the domain of the url which can be registered, e.g. "example.co.uk" of "https://login.example.co.uk"
+func registrableDomain(uri string) string {
+	if !strings.Contains(uri, "://") {
+		uri = fmt.Sprintf("http://%s", uri)
+	}
+	u, err := tld.Parse(uri)
+	if err != nil || u.Domain == "" {
+		return ""
+	}
+	return strings.ToLower(fmt.Sprintf("%s.%s", u.Domain, u.TLD))
+}
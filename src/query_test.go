@@ -0,0 +1,159 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseSearchQuery(t *testing.T) {
+	type args struct {
+		query string
+	}
+	tests := []struct {
+		name string
+		args args
+		want searchQuery
+	}{
+		{
+			name: "free text only",
+			args: args{
+				query: "github work",
+			},
+			want: searchQuery{
+				Text: "github work",
+			},
+		},
+		{
+			name: "qualifiers and free text",
+			args: args{
+				query: "type:login github -folder:Archive has:totp",
+			},
+			want: searchQuery{
+				Text: "github",
+				Qualifiers: []searchQualifier{
+					{Key: "type", Value: "login"},
+					{Key: "folder", Value: "Archive", Negate: true},
+					{Key: "has", Value: "totp"},
+				},
+			},
+		},
+		{
+			name: "quoted value",
+			args: args{
+				query: `folder:"Work Stuff" aws`,
+			},
+			want: searchQuery{
+				Text: "aws",
+				Qualifiers: []searchQualifier{
+					{Key: "folder", Value: "Work Stuff"},
+				},
+			},
+		},
+		{
+			name: "unknown qualifier and url stay free text",
+			args: args{
+				query: "foo:bar https://github.com type:",
+			},
+			want: searchQuery{
+				Text: "foo:bar https://github.com type:",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseSearchQuery(tt.args.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSearchQuery() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_filterItems(t *testing.T) {
+	items := []Item{
+		{
+			Id:       "1",
+			Type:     1,
+			Name:     "GitHub",
+			FolderId: "work",
+			Login: Login{
+				Username: "alice",
+				Totp:     "hidden",
+				Uris:     []Uri{{Uri: "https://github.com/login"}},
+			},
+		},
+		{
+			Id:       "2",
+			Type:     1,
+			Name:     "Old GitLab",
+			FolderId: "archive",
+			Favorite: true,
+			Login: Login{
+				Username: "bob",
+				Uris:     []Uri{{Uri: "https://gitlab.com"}},
+			},
+		},
+		{
+			Id:       "3",
+			Type:     3,
+			Name:     "Visa",
+			FolderId: "infra",
+		},
+	}
+	ctx := newSearchContext([]Folder{
+		{Id: "work", Name: "Work"},
+		{Id: "infra", Name: "Work/Infra"},
+		{Id: "archive", Name: "Archive"},
+	}, nil, nil)
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			name:  "type",
+			query: "type:login",
+			want:  []string{"1", "2"},
+		},
+		{
+			name:  "folder includes subfolders",
+			query: "folder:work",
+			want:  []string{"1", "3"},
+		},
+		{
+			name:  "negated folder",
+			query: "-folder:Archive",
+			want:  []string{"1", "3"},
+		},
+		{
+			name:  "has totp and user",
+			query: "has:totp user:ali",
+			want:  []string{"1"},
+		},
+		{
+			name:  "url host",
+			query: "url:gitlab.com",
+			want:  []string{"2"},
+		},
+		{
+			name:  "favorite",
+			query: "fav:true",
+			want:  []string{"2"},
+		},
+		{
+			name:  "no qualifiers",
+			query: "visa",
+			want:  []string{"1", "2", "3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, item := range filterItems(items, parseSearchQuery(tt.query), ctx) {
+				got = append(got, item.Id)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterItems() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
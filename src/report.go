@@ -0,0 +1,719 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blacs30/bitwarden-alfred-workflow/alfred"
+	aw "github.com/deanishe/awgo"
+	"github.com/deanishe/awgo/util"
+)
+
+// report is one of the vault health reports, run with the first argument of -report
+type report struct {
+	Name        string
+	Title       string
+	Description string
+	run         func(items []Item, args []string)
+}
+
+var reports = []report{
+	{
+		Name:        "reuse",
+		Title:       "Reused Passwords",
+		Description: "Logins which share the same password, the largest groups first",
+		run:         runReuseReport,
+	},
+	{
+		Name:        "weak",
+		Title:       "Weak Passwords",
+		Description: "Logins with an easy to guess password, the weakest first",
+		run:         runWeakReport,
+	},
+	{
+		Name:        "breached",
+		Title:       "Breached Passwords",
+		Description: "Logins with a password found in data breaches by Have I Been Pwned",
+		run:         runBreachedReport,
+	},
+	{
+		Name:        "aged",
+		Title:       "Aged Passwords",
+		Description: "Logins with a password older than the maximum age, grouped by age",
+		run:         runAgedReport,
+	},
+	{
+		Name:        "inactive2fa",
+		Title:       "Inactive Two-Factor Authentication",
+		Description: "Logins without TOTP for sites which support it",
+		run:         runInactive2faReport,
+	},
+	{
+		Name:        "hygiene",
+		Title:       "Vault Hygiene",
+		Description: "Insecure URLs, duplicates, empty fields, untitled items and expiring cards",
+		run:         runHygieneReport,
+	},
+}
+
+// runReport shows the menu of reports or runs the report named in the first argument
+func runReport() {
+	wf.Configure(aw.SuppressUIDs(true))
+	args := cli.Args()
+	if len(args) > 0 {
+		for _, r := range reports {
+			if r.Name == args[0] {
+				items, err := loadCachedItems()
+				if errors.Is(err, errCacheLocked) {
+					wf.NewWarningItem("Bitwarden is locked.", LOCKED_CACHE_MSG)
+					addUnlockItem(conf.Email)
+					wf.SendFeedback()
+					return
+				}
+				if isCacheInvalid(err) {
+					addRebuildingCacheItem(err, rebuildCache(err))
+					wf.SendFeedback()
+					return
+				}
+				if err != nil {
+					wf.FatalError(err)
+					return
+				}
+				r.run(items, args[1:])
+				wf.SendFeedback()
+				return
+			}
+		}
+	}
+
+	addBackToNormalSearchItem()
+	for _, r := range reports {
+		wf.NewItem(r.Title).
+			Subtitle(fmt.Sprintf("%s, ↩ or ⇥ run the report", r.Description)).
+			Valid(false).
+			UID(r.Name).
+			Autocomplete(r.Name + " ").
+			Icon(iconList)
+	}
+	if len(args) > 0 {
+		wf.Filter(queryArgs())
+	}
+	wf.WarnEmpty("No Report Found", "Try a different query?")
+	wf.SendFeedback()
+}
+
+// addReportsUpItem goes back to the menu of reports, or to the level of the report if name is set
+func addReportsUpItem(title string, name string) {
+	it := wf.NewItem(title).
+		Subtitle("↩ or ⇥ go up one level").
+		Icon(iconLevelUp)
+	if name != "" {
+		it.Valid(false).Autocomplete(name + " ")
+		return
+	}
+	// an empty autocomplete is ignored by Alfred, so the menu is opened with the keyword
+	it.Valid(true).
+		UID("").
+		Var("action", "-search").
+		Arg(conf.BwreportKeyword)
+}
+
+// addReportItem adds an item found by a report, ↩ opens the login url or the web vault and
+// the modifiers open the web vault, rotate the password of a login and show the item
+func addReportItem(item Item, subtitle string) *aw.Item {
+	webVault := fmt.Sprintf("%s/#/vault?itemId=%s", conf.WebUiURL, item.Id)
+	open := webVault
+	if len(item.Login.Uris) > 0 {
+		open = item.Login.Uris[0].Uri
+	}
+	title := item.Name
+	if strings.TrimSpace(title) == "" {
+		title = "(no name)"
+	}
+	actions := "↩ open, ⌘ Web UI, ⌃ show"
+	if item.Type == 1 {
+		actions = "↩ open, ⌘ Web UI, ⌥ rotate, ⌃ show"
+	}
+	it := wf.NewItem(title).
+		Subtitle(fmt.Sprintf("%s, %s", subtitle, actions)).
+		Valid(true).
+		UID(item.Id).
+		Icon(checkIconExistance(item)).
+		Match(itemMatchText(item, conf.SearchFieldWeights)).
+		Arg(open).
+		Var("action", "-open").
+		Var("action2", fmt.Sprintf("-id %s", item.Id)).
+		Var("action3", " ").
+		Var("notification", "")
+	it.NewModifier("cmd").
+		Subtitle("Open in Web UI").
+		Arg(webVault).
+		Var("action", "-open").
+		Var("action2", fmt.Sprintf("-id %s", item.Id)).
+		Var("action3", " ").
+		Var("notification", "")
+	if item.Type == 1 {
+		it.NewModifier("alt").
+			Subtitle("Rotate: copy a new password and open the login page to change it").
+			Arg("").
+			Var("action", "-rotate").
+			Var("action2", fmt.Sprintf("-id %s", item.Id)).
+			Var("action3", " ").
+			Var("notification", fmt.Sprintf("Copied new password for:\n%s\nChange it on the site and in Bitwarden.", item.Name))
+	}
+	it.NewModifier("ctrl").
+		Subtitle("Show item").
+		Arg(" ").
+		Var("action", fmt.Sprintf("-id %s", item.Id)).
+		Var("action2", " ").
+		Var("action3", " ").
+		Var("notification", " ")
+	return it
+}
+
+// vaultReader decrypts secrets of the items directly from the data.json of the Bitwarden CLI,
+// like runGetItem does. The data is read once for all the items of a report.
+type vaultReader struct {
+	data []byte
+	key  CryptoKey
+}
+
+func newVaultReader() (*vaultReader, error) {
+	if bwData.UserId == "" {
+		return nil, errors.New(NOT_LOGGED_IN_MSG)
+	}
+	if bwData.ProtectedKey == "" {
+		return nil, errors.New(NOT_UNLOCKED_MSG)
+	}
+	token, err := alfred.GetToken(wf)
+	if err != nil {
+		return nil, fmt.Errorf("get token error: %w", err)
+	}
+	key, err := MakeDecryptKeyFromSession(bwData.ProtectedKey, token)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(bwData.path)
+	if err != nil {
+		return nil, err
+	}
+	return &vaultReader{data: data, key: key}, nil
+}
+
+// decrypt returns the decrypted value at the jsonPath of the item, items of an
+// organization are encrypted with the organization key and fail here
+func (r *vaultReader) decrypt(id string, jsonPath string) (string, error) {
+	value := lookupEncryptedValue(r.data, id, jsonPath)
+	if !value.Exists() {
+		return "", fmt.Errorf("no value for %s of item %s", jsonPath, id)
+	}
+	return DecryptString(value.String(), r.key)
+}
+
+// passwordHasher keeps only salted hashes of the passwords, the salt is random for each
+// run and never stored, so the hashes can't be compared to anything outside of the run
+type passwordHasher struct {
+	salt []byte
+}
+
+func newPasswordHasher() (*passwordHasher, error) {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return &passwordHasher{salt: salt}, nil
+}
+
+func (h *passwordHasher) sum(password string) string {
+	mac := hmac.New(sha256.New, h.salt)
+	mac.Write([]byte(password))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// forEachPassword decrypts the password of every login which has one and passes it to fn,
+// the password must not be kept. It returns the number of logins which couldn't be decrypted locally.
+func forEachPassword(items []Item, reader *vaultReader, fn func(item Item, password string)) int {
+	return forEachPasswordUntil(items, reader, func(item Item, password string) bool {
+		fn(item, password)
+		return false
+	})
+}
+
+// forEachPasswordUntil is forEachPassword which stops once fn returns true, before the next password is decrypted
+func forEachPasswordUntil(items []Item, reader *vaultReader, fn func(item Item, password string) bool) int {
+	failed := 0
+	for _, item := range items {
+		if item.Type != 1 || item.Login.Password == "" {
+			continue
+		}
+		password, err := reader.decrypt(item.Id, "login.password")
+		if err != nil {
+			debugLog(fmt.Sprintf("Couldn't decrypt the password of %s: %s", item.Id, err))
+			failed++
+			continue
+		}
+		if fn(item, password) {
+			break
+		}
+	}
+	return failed
+}
+
+// passwordHashes returns the salted password hashes of the logins by item id and
+// the number of logins whose password couldn't be decrypted locally
+func passwordHashes(items []Item, reader *vaultReader, hasher *passwordHasher) (map[string]string, int) {
+	hashes := map[string]string{}
+	failed := forEachPassword(items, reader, func(item Item, password string) {
+		hashes[item.Id] = hasher.sum(password)
+	})
+	return hashes, failed
+}
+
+// addUndecryptedItem shows how many logins are missing in a report
+func addUndecryptedItem(failed int) {
+	if failed == 0 {
+		return
+	}
+	wf.NewItem(fmt.Sprintf("%d logins couldn't be decrypted locally", failed)).
+		Subtitle("They aren't part of the report, e.g. items of organizations.").
+		Valid(false).
+		Icon(iconWarning)
+}
+
+// reuseGroup are the logins sharing a password
+type reuseGroup struct {
+	// Id only depends on the item ids, so it stays the same across runs without involving the password
+	Id    string
+	Items []Item
+}
+
+// reuseGroups groups the items by their password hash, only groups of two or more items are returned, largest first
+func reuseGroups(items []Item, hashes map[string]string) []reuseGroup {
+	byHash := map[string][]Item{}
+	var order []string
+	for _, item := range items {
+		hash, ok := hashes[item.Id]
+		if !ok {
+			continue
+		}
+		if _, ok := byHash[hash]; !ok {
+			order = append(order, hash)
+		}
+		byHash[hash] = append(byHash[hash], item)
+	}
+
+	var groups []reuseGroup
+	for _, hash := range order {
+		grouped := byHash[hash]
+		if len(grouped) < 2 {
+			continue
+		}
+		ids := make([]string, 0, len(grouped))
+		for _, item := range grouped {
+			ids = append(ids, item.Id)
+		}
+		sort.Strings(ids)
+		sum := sha256.Sum256([]byte(strings.Join(ids, ",")))
+		groups = append(groups, reuseGroup{Id: hex.EncodeToString(sum[:])[:16], Items: grouped})
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].Items) > len(groups[j].Items)
+	})
+	return groups
+}
+
+func itemNames(items []Item) string {
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		names = append(names, item.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// runReuseReport lists the groups of logins sharing a password, "reuse <group id>" lists the logins of a group
+func runReuseReport(items []Item, args []string) {
+	reader, err := newVaultReader()
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+	hasher, err := newPasswordHasher()
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+	hashes, failed := passwordHashes(items, reader, hasher)
+	groups := reuseGroups(items, hashes)
+
+	if len(args) > 0 {
+		for _, group := range groups {
+			if group.Id != args[0] {
+				continue
+			}
+			addReportsUpItem(fmt.Sprintf("Reused Passwords › Used by %d logins", len(group.Items)), "reuse")
+			for _, item := range group.Items {
+				addReportItem(item, fmt.Sprintf("Same password as %d other logins", len(group.Items)-1))
+			}
+			if len(args) > 1 {
+				wf.Filter(strings.Join(args[1:], " "))
+			}
+			return
+		}
+		log.Printf("reuse group %s not found, the passwords changed", args[0])
+	}
+
+	addReportsUpItem("Reports › Reused Passwords", "")
+	addUndecryptedItem(failed)
+	for _, group := range groups {
+		wf.NewItem(fmt.Sprintf("Used by %d logins", len(group.Items))).
+			Subtitle(itemNames(group.Items)).
+			Valid(false).
+			UID(group.Id).
+			Match(itemNames(group.Items)).
+			Autocomplete(fmt.Sprintf("reuse %s ", group.Id)).
+			Icon(iconPassword)
+	}
+	if len(args) > 0 {
+		wf.Filter(strings.Join(args, " "))
+	}
+	wf.WarnEmpty("No Reused Passwords Found", "Every login has its own password.")
+}
+
+// weakPassword is a login of the weak passwords report, only the strength of the password is kept
+type weakPassword struct {
+	Item     Item
+	Strength passwordStrength
+}
+
+// runWeakReport lists the logins whose password strength is below WEAK_PASSWORD_SCORE
+func runWeakReport(items []Item, args []string) {
+	reader, err := newVaultReader()
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+	var weak []weakPassword
+	failed := forEachPassword(items, reader, func(item Item, password string) {
+		strength := estimatePasswordStrength(password, item.Name, item.Login.Username)
+		if strength.Score < conf.WeakPasswordScore {
+			weak = append(weak, weakPassword{Item: item, Strength: strength})
+		}
+	})
+	sort.SliceStable(weak, func(i, j int) bool {
+		return weak[i].Strength.Log10Guesses < weak[j].Strength.Log10Guesses
+	})
+
+	addReportsUpItem("Reports › Weak Passwords", "")
+	addUndecryptedItem(failed)
+	for _, w := range weak {
+		addReportItem(w.Item, fmt.Sprintf("Score %d/%d: %s", w.Strength.Score, maxStrengthScore, strings.Join(w.Strength.Reasons, ", ")))
+	}
+	if len(args) > 0 {
+		wf.Filter(strings.Join(args, " "))
+	}
+	wf.WarnEmpty("No Weak Passwords Found", fmt.Sprintf("Every password has a score of at least %d.", conf.WeakPasswordScore))
+}
+
+// breachedPassword is a login of the breached passwords report
+type breachedPassword struct {
+	Item  Item
+	Count int
+}
+
+// runBreachedReport lists the logins whose password is known from data breaches, the most common first.
+// The passwords are checked by the hibp job, the report only shows its stored results.
+func runBreachedReport(items []Item, args []string) {
+	check, err := loadBreachCheck()
+	if err != nil {
+		log.Printf("Couldn't load the breach check, error: %s", err)
+	}
+	running := wf.IsRunning("hibp")
+	if !running && check.Started.IsZero() {
+		startBreachCheck()
+		running = true
+	}
+	breached, unchecked := check.breached(items)
+
+	addReportsUpItem("Reports › Breached Passwords", "")
+	if running {
+		wf.NewItem("Checking the passwords…").
+			Subtitle(fmt.Sprintf("%d of %d logins checked, the results are shown while checking", len(check.Results), check.Total)).
+			Valid(false).
+			Icon(iconReload)
+		wf.Rerun(1)
+	} else {
+		title := fmt.Sprintf("Checked %s", check.Finished.Local().Format("2006-01-02 15:04"))
+		subtitle := "↩ check again"
+		icon := iconReload
+		if check.Error != "" {
+			title = "The check stopped"
+			subtitle = fmt.Sprintf("%s, ↩ check again", check.Error)
+			icon = iconWarning
+		} else if unchecked > 0 {
+			title = fmt.Sprintf("%d logins weren't checked yet or changed since", unchecked)
+		}
+		wf.NewItem(title).
+			Subtitle(subtitle).
+			Valid(true).
+			UID("hibp").
+			Icon(icon).
+			Var("action", "-hibp").
+			Var("notification", "Checking the passwords").
+			Arg("-background")
+	}
+	addUndecryptedItem(check.Undecrypted)
+	if check.Failed > 0 {
+		wf.NewItem(fmt.Sprintf("%d passwords couldn't be checked", check.Failed)).
+			Subtitle("The details are in the log of the workflow.").
+			Valid(false).
+			Icon(iconWarning)
+	}
+	for _, b := range breached {
+		addReportItem(b.Item, fmt.Sprintf("Seen %d times in data breaches", b.Count))
+	}
+	if len(args) > 0 {
+		wf.Filter(strings.Join(args, " "))
+	}
+	wf.WarnEmpty("No Breached Passwords Found", "None of the passwords is known from data breaches.")
+}
+
+// loadCachedSearchContext reads the names of the folders, collections and organizations from the cache
+func loadCachedSearchContext() searchContext {
+	var folders []Folder
+	var collections []Collection
+	var organizations []Organization
+	for name, v := range map[string]interface{}{
+		FOLDER_CACHE_NAME:       &folders,
+		COLLECTION_CACHE_NAME:   &collections,
+		ORGANIZATION_CACHE_NAME: &organizations,
+	} {
+		if !wf.Cache.Exists(name) {
+			continue
+		}
+		if err := wf.Cache.LoadJSON(name, v); err != nil {
+			log.Printf("Couldn't load the %s cache, error: %s", name, err)
+		}
+	}
+	return newSearchContext(folders, collections, organizations)
+}
+
+// agedPassword is a login of the aged passwords report
+type agedPassword struct {
+	Item   Item
+	Age    time.Duration
+	Never  bool
+	MaxAge time.Duration
+	Source string
+}
+
+func (a agedPassword) subtitle() string {
+	maxAge := fmt.Sprintf("max %s", formatAge(a.MaxAge))
+	if a.Source != "" {
+		maxAge = fmt.Sprintf("%s by %s", maxAge, a.Source)
+	}
+	if a.Never {
+		return fmt.Sprintf("Never changed, created %s ago, %s", formatAge(a.Age), maxAge)
+	}
+	return fmt.Sprintf("Changed %s ago, %s", formatAge(a.Age), maxAge)
+}
+
+// runAgedReport lists the buckets of logins with a password older than PASSWORD_MAX_AGE or the
+// maximum age of the PASSWORD_AGE_POLICY, "aged <bucket>" lists the logins of a bucket
+func runAgedReport(items []Item, args []string) {
+	policy, err := loadPasswordAgePolicy(conf.PasswordAgePolicy, conf.PasswordMaxAge)
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+	ctx := loadCachedSearchContext()
+	now := time.Now()
+	buckets := map[string][]agedPassword{}
+	for _, item := range items {
+		if item.Type != 1 || item.Login.Password == "" {
+			continue
+		}
+		age, never := passwordAge(item, now)
+		maxAge, source := policy.maxAge(item, ctx)
+		if name, ok := agedBucketName(age, never, maxAge); ok {
+			buckets[name] = append(buckets[name], agedPassword{Item: item, Age: age, Never: never, MaxAge: maxAge, Source: source})
+		}
+	}
+	for _, aged := range buckets {
+		sort.SliceStable(aged, func(i, j int) bool { return aged[i].Age > aged[j].Age })
+	}
+
+	if len(args) > 0 {
+		for _, bucket := range agedBuckets {
+			if bucket.Name != args[0] {
+				continue
+			}
+			addReportsUpItem(fmt.Sprintf("Aged Passwords › %s", bucket.Title), "aged")
+			for _, aged := range buckets[bucket.Name] {
+				addReportItem(aged.Item, aged.subtitle())
+			}
+			if len(args) > 1 {
+				wf.Filter(strings.Join(args[1:], " "))
+			}
+			wf.WarnEmpty("No Aged Passwords Found", "No login is in this group anymore.")
+			return
+		}
+	}
+
+	addReportsUpItem("Reports › Aged Passwords", "")
+	for _, bucket := range agedBuckets {
+		aged := buckets[bucket.Name]
+		if len(aged) == 0 {
+			continue
+		}
+		bucketItems := make([]Item, 0, len(aged))
+		for _, a := range aged {
+			bucketItems = append(bucketItems, a.Item)
+		}
+		wf.NewItem(fmt.Sprintf("%s: %d logins", bucket.Title, len(aged))).
+			Subtitle(itemNames(bucketItems)).
+			Valid(false).
+			UID(bucket.Name).
+			Autocomplete(fmt.Sprintf("aged %s ", bucket.Name)).
+			Icon(iconDate)
+	}
+	if len(args) > 0 {
+		wf.Filter(strings.Join(args, " "))
+	}
+	wf.WarnEmpty("No Aged Passwords Found", "Every password was changed within its maximum age.")
+}
+
+// runInactive2faReport lists the logins without TOTP whose site supports it according to the 2factorauth directory
+func runInactive2faReport(items []Item, args []string) {
+	directory, err := loadTwoFactorDirectory()
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+
+	addReportsUpItem("Reports › Inactive Two-Factor Authentication", "")
+	if wf.IsRunning("2fa-directory") {
+		wf.NewItem("Downloading the 2FA directory in the background…").
+			Subtitle("Showing the sites of the previous directory, open the report again when it's done.").
+			Valid(false).
+			Icon(iconReload)
+	}
+	for _, item := range items {
+		if item.Type != 1 || item.Login.Totp != "" {
+			continue
+		}
+		site, ok := directory.lookup(item)
+		if !ok {
+			continue
+		}
+		docs := site.Documentation
+		if docs == "" {
+			docs = twoFactorDirectoryDocs
+		}
+		it := addReportItem(item, fmt.Sprintf("%s supports TOTP, ⇧ 2FA docs", site.Name))
+		it.NewModifier("shift").
+			Subtitle(fmt.Sprintf("Open how to enable 2FA: %s", docs)).
+			Arg(docs).
+			Var("action", "-open").
+			Var("action2", " ").
+			Var("action3", " ").
+			Var("notification", "")
+	}
+	if len(args) > 0 {
+		wf.Filter(strings.Join(args, " "))
+	}
+	wf.WarnEmpty("No Inactive Two-Factor Authentication Found", "Every login of a site supporting TOTP has a TOTP.")
+}
+
+// runHygieneReport lists the sections of the hygiene report with their counts, "hygiene <section>" lists the items of a section
+func runHygieneReport(items []Item, args []string) {
+	findings := hygieneFindings(items, time.Now())
+
+	if len(args) > 0 {
+		for _, section := range hygieneSections {
+			if section.Name != args[0] {
+				continue
+			}
+			addReportsUpItem(fmt.Sprintf("Vault Hygiene › %s", section.Title), "hygiene")
+			for _, finding := range findings[section.Name] {
+				addReportItem(finding.Item, finding.Detail)
+			}
+			if len(args) > 1 {
+				wf.Filter(strings.Join(args[1:], " "))
+			}
+			wf.WarnEmpty("Nothing Found", "No item has this problem anymore.")
+			return
+		}
+	}
+
+	addReportsUpItem("Reports › Vault Hygiene", "")
+	for _, section := range hygieneSections {
+		found := findings[section.Name]
+		it := wf.NewItem(fmt.Sprintf("%s: %d", section.Title, len(found))).
+			UID(section.Name).
+			Icon(iconList)
+		if len(found) == 0 {
+			it.Subtitle("Nothing found").Valid(false)
+			continue
+		}
+		sectionItems := make([]Item, 0, len(found))
+		for _, finding := range found {
+			sectionItems = append(sectionItems, finding.Item)
+		}
+		it.Subtitle(itemNames(sectionItems)).
+			Valid(false).
+			Autocomplete(fmt.Sprintf("hygiene %s ", section.Name))
+	}
+	if len(args) > 0 {
+		wf.Filter(strings.Join(args, " "))
+	}
+}
+
+// runRotate generates a new password, prints it for the clipboard and opens the login page to change it
+func runRotate() {
+	wf.Configure(aw.TextErrors(true))
+	if opts.Id == "" {
+		wf.Fatal("No id sent.")
+		return
+	}
+	args := fmt.Sprintf("%s generate -ulns --length %d", conf.BwExec, conf.RotatePasswordLength)
+	result, err := runCmd(args, "Failed to generate a password.")
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+	password := strings.TrimSpace(strings.Join(result, ""))
+	if password == "" {
+		wf.Fatal("Bitwarden generated an empty password.")
+		return
+	}
+
+	open := fmt.Sprintf("%s/#/vault?itemId=%s", conf.WebUiURL, opts.Id)
+	if items, err := loadCachedItems(); err == nil {
+		for _, item := range items {
+			if item.Id == opts.Id && len(item.Login.Uris) > 0 {
+				open = item.Login.Uris[0].Uri
+			}
+		}
+	} else {
+		log.Println(err)
+	}
+	cmd := exec.Command("/usr/bin/open", open)
+	if _, err := util.RunCmd(cmd); err != nil {
+		log.Printf("/usr/bin/open %q: %v", open, err)
+	}
+	recordUsage(opts.Id)
+	fmt.Print(password)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_reuseGroups(t *testing.T) {
+	hasher := &passwordHasher{salt: []byte("salt")}
+	items := []Item{
+		{Id: "a", Name: "A"},
+		{Id: "b", Name: "B"},
+		{Id: "c", Name: "C"},
+		{Id: "d", Name: "D"},
+		{Id: "e", Name: "E"},
+		{Id: "f", Name: "F"},
+		// no password, e.g. not decryptable
+		{Id: "g", Name: "G"},
+	}
+	hashes := map[string]string{
+		"a": hasher.sum("secret"),
+		"b": hasher.sum("hunter2"),
+		"c": hasher.sum("hunter2"),
+		"d": hasher.sum("secret"),
+		"e": hasher.sum("hunter2"),
+		"f": hasher.sum("unique"),
+	}
+
+	groups := reuseGroups(items, hashes)
+	var got [][]string
+	for _, group := range groups {
+		var ids []string
+		for _, item := range group.Items {
+			ids = append(ids, item.Id)
+		}
+		got = append(got, ids)
+	}
+	want := [][]string{{"b", "c", "e"}, {"a", "d"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("reuseGroups() = %v, want %v", got, want)
+	}
+
+	t.Run("group id doesn't depend on the password or the salt", func(t *testing.T) {
+		other := &passwordHasher{salt: []byte("other salt")}
+		again := reuseGroups(items, map[string]string{"a": other.sum("new"), "d": other.sum("new")})
+		if len(again) != 1 || again[0].Id != groups[1].Id {
+			t.Errorf("group id = %v, want %s", again, groups[1].Id)
+		}
+	})
+
+	t.Run("salted hashes differ per run", func(t *testing.T) {
+		first, err := newPasswordHasher()
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := newPasswordHasher()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first.sum("secret") == second.sum("secret") || first.sum("secret") != first.sum("secret") {
+			t.Error("hashes must be stable within a run and differ across runs")
+		}
+	})
+}
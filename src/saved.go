@@ -0,0 +1,183 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/ncruces/zenity"
+)
+
+// savedSearch is a named query, the query can contain qualifiers like "folder:Work type:login has:totp"
+type savedSearch struct {
+	Id    string `json:"id"`
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+// savedSearchId turns the name into an id which can be used as keyword argument, e.g. "Work TOTP" to "work-totp"
+func savedSearchId(name string) string {
+	var id strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			id.WriteRune(r)
+			dash = false
+		} else if !dash && id.Len() > 0 {
+			id.WriteRune('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(id.String(), "-")
+}
+
+func loadSavedSearches() ([]savedSearch, error) {
+	var searches []savedSearch
+	if !wf.Data.Exists(SAVED_SEARCHES_NAME) {
+		return searches, nil
+	}
+	err := wf.Data.LoadJSON(SAVED_SEARCHES_NAME, &searches)
+	return searches, err
+}
+
+func findSavedSearch(searches []savedSearch, id string) (savedSearch, error) {
+	for _, search := range searches {
+		if search.Id == id {
+			return search, nil
+		}
+	}
+	return savedSearch{}, fmt.Errorf("no saved search with id %q", id)
+}
+
+// savedSearchQuery combines the query of the saved search with the typed query
+func savedSearchQuery(searches []savedSearch, id string, query string) string {
+	search, err := findSavedSearch(searches, id)
+	if err != nil {
+		log.Println(err)
+		return query
+	}
+	log.Printf("using saved search %q: %s", search.Name, search.Query)
+	return strings.TrimSpace(fmt.Sprintf("%s %s", search.Query, query))
+}
+
+// addSaveSearchItem offers to save the query as named search
+func addSaveSearchItem(query string) {
+	if strings.TrimSpace(query) == "" {
+		return
+	}
+	wf.NewItem(fmt.Sprintf("Save search %q", query)).
+		Subtitle("↩ save the search with a name, find it in the settings under Saved Searches").
+		Valid(true).
+		UID("").
+		Icon(iconStar).
+		Arg(query).
+		Var("action", "-savesearch").
+		Var("notification", fmt.Sprintf("Saved search:\n%s", query))
+}
+
+// runSaveSearch asks for a name and saves the query, a saved search with the same id is replaced
+func runSaveSearch() {
+	wf.Configure(aw.TextErrors(true))
+	query := strings.TrimSpace(queryArgs())
+	if query == "" {
+		wf.Fatal("No query to save.")
+		return
+	}
+	name, err := zenity.Entry("Name of the saved search:",
+		zenity.Title("Save Bitwarden search"),
+		zenity.EntryText(query))
+	if err != nil || strings.TrimSpace(name) == "" {
+		log.Println("Saving the search was canceled.")
+		return
+	}
+	id := savedSearchId(name)
+	if id == "" {
+		wf.Fatal("The name needs at least one letter or digit.")
+		return
+	}
+
+	searches, err := loadSavedSearches()
+	if err != nil {
+		log.Printf("Couldn't load the saved searches, error: %s", err)
+	}
+	saved := savedSearch{Id: id, Name: strings.TrimSpace(name), Query: query}
+	replaced := false
+	for i, search := range searches {
+		if search.Id == id {
+			searches[i] = saved
+			replaced = true
+		}
+	}
+	if !replaced {
+		searches = append(searches, saved)
+	}
+	if err := wf.Data.StoreJSON(SAVED_SEARCHES_NAME, searches); err != nil {
+		wf.FatalError(err)
+		return
+	}
+	fmt.Print(saved.Name)
+}
+
+// runDeleteSaved deletes the saved search with the id
+func runDeleteSaved() {
+	wf.Configure(aw.TextErrors(true))
+	searches, err := loadSavedSearches()
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+	var kept []savedSearch
+	for _, search := range searches {
+		if search.Id != opts.Id {
+			kept = append(kept, search)
+		}
+	}
+	if err := wf.Data.StoreJSON(SAVED_SEARCHES_NAME, kept); err != nil {
+		wf.FatalError(err)
+		return
+	}
+	fmt.Print("Deleted saved search")
+}
+
+// runSaved lists the saved searches, ↩ opens the search pre-filtered
+func runSaved() {
+	searches, err := loadSavedSearches()
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+	addBackToNormalSearchItem()
+	for _, search := range searches {
+		it := wf.NewItem(search.Name).
+			Subtitle(fmt.Sprintf("↩ search %q, ⌘ copy keyword argument, ⌃ delete", search.Query)).
+			Valid(true).
+			UID(search.Id).
+			Icon(iconStar).
+			Arg(fmt.Sprintf("%s %s ", conf.BwKeyword, search.Query)).
+			Var("action", "-search").
+			Var("notification", "")
+		it.NewModifier("cmd").
+			Subtitle(fmt.Sprintf("Copy %q to use it in the script of your own Script Filter", fmt.Sprintf("-savedsearch %s", search.Id))).
+			Arg(fmt.Sprintf("-savedsearch %s", search.Id)).
+			Var("action", "output").
+			Var("notification", fmt.Sprintf("Copied keyword argument of:\n%s", search.Name))
+		it.NewModifier("ctrl").
+			Subtitle("Delete saved search").
+			Icon(aw.IconTrash).
+			Arg("").
+			Var("action", "-deletesaved").
+			Var("action2", fmt.Sprintf("-id %s", search.Id)).
+			Var("notification", fmt.Sprintf("Deleted saved search:\n%s", search.Name))
+	}
+
+	if opts.Query != "" {
+		wf.Filter(queryArgs())
+	}
+	wf.WarnEmpty("No Saved Searches Found", "Save a search from the results of a search.")
+	wf.SendFeedback()
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func Test_savedSearchId(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Work TOTP", want: "work-totp"},
+		{name: "  Work   TOTP  ", want: "work-totp"},
+		{name: "Cards & Banks!", want: "cards-banks"},
+		{name: "--github--", want: "github"},
+		{name: "Büro 2", want: "büro-2"},
+		{name: "!!!", want: ""},
+		{name: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := savedSearchId(tt.name); got != tt.want {
+				t.Errorf("savedSearchId(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_savedSearchQuery(t *testing.T) {
+	searches := []savedSearch{
+		{Id: "work-totp", Name: "Work TOTP", Query: "folder:Work has:totp"},
+		{Id: "cards", Name: "Cards", Query: "type:card"},
+	}
+	tests := []struct {
+		name  string
+		id    string
+		query string
+		want  string
+	}{
+		{name: "saved query only", id: "work-totp", want: "folder:Work has:totp"},
+		{name: "typed text is appended", id: "cards", query: "visa", want: "type:card visa"},
+		{name: "unknown id keeps the query", id: "missing", query: "github", want: "github"},
+		{name: "unknown id without query", id: "missing", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := savedSearchQuery(searches, tt.id, tt.query); got != tt.want {
+				t.Errorf("savedSearchQuery() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Fields of the search index, the weights are configured with SEARCH_WEIGHTS
+const (
+	searchFieldName     = "name"
+	searchFieldUsername = "username"
+	searchFieldUri      = "uri"
+	searchFieldField    = "field"
+	searchFieldIdentity = "identity"
+	searchFieldCard     = "card"
+)
+
+var defaultSearchWeights = map[string]float64{
+	searchFieldName:     10,
+	searchFieldUsername: 6,
+	searchFieldUri:      5,
+	searchFieldField:    3,
+	searchFieldIdentity: 2,
+	searchFieldCard:     2,
+}
+
+type searchField struct {
+	Kind  string
+	Label string
+	Value string
+}
+
+type indexedItem struct {
+	Item   Item
+	Fields []searchField
+}
+
+type searchIndex struct {
+	Items   []indexedItem
+	Weights map[string]float64
+}
+
+type searchResult struct {
+	Item    Item
+	Score   float64
+	Matched searchField
+}
+
+// parseSearchWeights reads weights like "name:10,username:6", unknown fields are ignored
+// and fields which aren't set keep their default weight
+func parseSearchWeights(weights string) map[string]float64 {
+	parsed := map[string]float64{}
+	for field, weight := range defaultSearchWeights {
+		parsed[field] = weight
+	}
+	for _, pair := range strings.Split(weights, ",") {
+		field, value, found := strings.Cut(strings.TrimSpace(pair), ":")
+		if !found {
+			continue
+		}
+		if _, ok := defaultSearchWeights[field]; !ok {
+			log.Printf("Unknown search field %q in SEARCH_WEIGHTS", field)
+			continue
+		}
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			log.Printf("Invalid weight %q for search field %q", value, field)
+			continue
+		}
+		parsed[field] = weight
+	}
+	return parsed
+}
+
+// itemSearchFields collects the non-secret values of the item which are searched
+func itemSearchFields(item Item) []searchField {
+	fields := []searchField{{Kind: searchFieldName, Label: "name", Value: item.Name}}
+	if item.Login.Username != "" {
+		fields = append(fields, searchField{Kind: searchFieldUsername, Label: "username", Value: item.Login.Username})
+	}
+	for _, uri := range item.Login.Uris {
+		fields = append(fields, searchField{Kind: searchFieldUri, Label: "url", Value: uriHost(uri.Uri)})
+	}
+	for _, field := range item.Fields {
+		fields = append(fields, searchField{Kind: searchFieldField, Label: "field", Value: field.Name})
+		// hidden fields are cached with the value "hidden"
+		if field.Type != 1 && field.Value != "" {
+			fields = append(fields, searchField{Kind: searchFieldField, Label: field.Name, Value: field.Value})
+		}
+	}
+	identity := []struct {
+		label string
+		value string
+	}{
+		{"name", strings.Join(strings.Fields(fmt.Sprintf("%s %s %s", item.Identity.FirstName, item.Identity.MiddleName, item.Identity.LastName)), " ")},
+		{"company", item.Identity.Company},
+		{"email", item.Identity.Email},
+		{"username", item.Identity.Username},
+		{"city", item.Identity.City},
+		{"country", item.Identity.Country},
+	}
+	for _, entry := range identity {
+		if entry.value != "" {
+			fields = append(fields, searchField{Kind: searchFieldIdentity, Label: entry.label, Value: entry.value})
+		}
+	}
+	card := []struct {
+		label string
+		value string
+	}{
+		{"brand", item.Card.Brand},
+		{"card holder", item.Card.CardHolderName},
+		{"card number", item.Card.Number},
+	}
+	for _, entry := range card {
+		if entry.value != "" {
+			fields = append(fields, searchField{Kind: searchFieldCard, Label: entry.label, Value: entry.value})
+		}
+	}
+	return fields
+}
+
+// itemMatchText joins the searched values of the item for Alfred's own filtering
+func itemMatchText(item Item, weights map[string]float64) string {
+	var values []string
+	for _, field := range itemSearchFields(item) {
+		if weights[field.Kind] > 0 {
+			values = append(values, field.Value)
+		}
+	}
+	return strings.Join(values, " ")
+}
+
+func newSearchIndex(items []Item, weights map[string]float64) searchIndex {
+	index := searchIndex{Weights: weights}
+	for _, item := range items {
+		index.Items = append(index.Items, indexedItem{Item: item, Fields: itemSearchFields(item)})
+	}
+	return index
+}
+
+// Search returns the items matching all words of the query, ordered by their weighted score.
+// Items with the same score keep the order of the vault.
+func (index searchIndex) Search(query string) []searchResult {
+	terms := strings.Fields(strings.ToLower(query))
+	var results []searchResult
+	for _, indexed := range index.Items {
+		result := searchResult{Item: indexed.Item}
+		matchedAll := true
+		best := 0.0
+		for _, term := range terms {
+			termScore := 0.0
+			for _, field := range indexed.Fields {
+				score := index.Weights[field.Kind] * matchQuality(strings.ToLower(field.Value), term)
+				if score > termScore {
+					termScore = score
+				}
+				if score > best {
+					best = score
+					result.Matched = field
+				}
+			}
+			if termScore == 0 {
+				matchedAll = false
+				break
+			}
+			result.Score += termScore
+		}
+		if matchedAll && len(terms) > 0 {
+			results = append(results, result)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results
+}
+
+// matchQuality rates how well the term matches the value, from 1 for equal to 0 for no match
+func matchQuality(value string, term string) float64 {
+	switch {
+	case value == term:
+		return 1
+	case strings.HasPrefix(value, term):
+		return 0.8
+	case hasWordPrefix(value, term):
+		return 0.6
+	case strings.Contains(value, term):
+		return 0.4
+	case isSubsequence(term, value):
+		return 0.1
+	}
+	return 0
+}
+
+// hasWordPrefix checks if a word inside the value starts with the term, e.g. "mail" in "gmail.com" doesn't but "com" does
+func hasWordPrefix(value string, term string) bool {
+	for i := 1; i < len(value); i++ {
+		r := rune(value[i-1])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && strings.HasPrefix(value[i:], term) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSubsequence checks if all characters of term appear in value in the same order
+func isSubsequence(term string, value string) bool {
+	remaining := []rune(term)
+	for _, r := range value {
+		if len(remaining) == 0 {
+			break
+		}
+		if r == remaining[0] {
+			remaining = remaining[1:]
+		}
+	}
+	return len(remaining) == 0
+}
+
+// matchedLabel describes which field matched, it's empty for the name because that's the title
+func (result searchResult) matchedLabel() string {
+	if result.Matched.Kind == "" || result.Matched.Kind == searchFieldName {
+		return ""
+	}
+	return fmt.Sprintf("%s: %s", result.Matched.Label, result.Matched.Value)
+}
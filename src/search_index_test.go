@@ -0,0 +1,116 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseSearchWeights(t *testing.T) {
+	got := parseSearchWeights("name:4, uri:0,unknown:3,card:x")
+	want := map[string]float64{
+		searchFieldName:     4,
+		searchFieldUsername: 6,
+		searchFieldUri:      0,
+		searchFieldField:    3,
+		searchFieldIdentity: 2,
+		searchFieldCard:     2,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSearchWeights() = %v, want %v", got, want)
+	}
+}
+
+func Test_searchIndex_Search(t *testing.T) {
+	items := []Item{
+		{
+			Id:    "1",
+			Type:  1,
+			Name:  "Work Mail",
+			Login: Login{Username: "github-bot", Uris: []Uri{{Uri: "https://mail.example.com"}}},
+		},
+		{
+			Id:    "2",
+			Type:  1,
+			Name:  "GitHub",
+			Login: Login{Username: "alice", Uris: []Uri{{Uri: "https://github.com/login"}}},
+		},
+		{
+			Id:     "3",
+			Type:   2,
+			Name:   "Server",
+			Fields: []Field{{Name: "hostname", Value: "db.internal", Type: 0}, {Name: "token", Value: "hidden", Type: 1}},
+		},
+		{
+			Id:   "4",
+			Type: 3,
+			Name: "Visa",
+			Card: CardInfo{Brand: "Visa", CardHolderName: "Alice Example"},
+		},
+	}
+	tests := []struct {
+		name        string
+		query       string
+		weights     string
+		want        []string
+		wantMatched string
+	}{
+		{
+			name:        "name ranks before username",
+			query:       "github",
+			want:        []string{"2", "1"},
+			wantMatched: "",
+		},
+		{
+			name:        "username",
+			query:       "alice",
+			want:        []string{"2", "4"},
+			wantMatched: "username: alice",
+		},
+		{
+			name:        "custom field value",
+			query:       "db.internal",
+			want:        []string{"3"},
+			wantMatched: "hostname: db.internal",
+		},
+		{
+			name:  "hidden field value isn't searched",
+			query: "hidden",
+			want:  nil,
+		},
+		{
+			name:        "all words must match",
+			query:       "work example",
+			want:        []string{"1"},
+			wantMatched: "",
+		},
+		{
+			name:    "weight 0 disables the field",
+			query:   "alice",
+			weights: "username:0",
+			want:    []string{"4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := newSearchIndex(items, parseSearchWeights(tt.weights))
+			results := index.Search(tt.query)
+			var got []string
+			for _, r := range results {
+				got = append(got, r.Item.Id)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search() = %v, want %v", got, tt.want)
+			}
+			if len(results) > 0 && tt.wantMatched != "" && results[0].matchedLabel() != tt.wantMatched {
+				t.Errorf("matchedLabel() = %q, want %q", results[0].matchedLabel(), tt.wantMatched)
+			}
+		})
+	}
+}
+
+func Test_itemMatchText(t *testing.T) {
+	item := Item{Name: "GitHub", Login: Login{Username: "octocat", Uris: []Uri{{Uri: "https://github.com/login"}}}}
+	if got := itemMatchText(item, parseSearchWeights("username:0")); got != "GitHub github.com" {
+		t.Errorf("itemMatchText() = %q, want the values of the weighted fields", got)
+	}
+}
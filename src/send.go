@@ -0,0 +1,522 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blacs30/bitwarden-alfred-workflow/alfred"
+	aw "github.com/deanishe/awgo"
+	"github.com/jychri/tilde"
+)
+
+// Bitwarden deletes a Send after 7 days by default
+const defaultSendDeletionDays = 7
+
+const sendsKeyName = "sendsPassword"
+
+// sendOptions are the settings of a new Send, read from the
+// workflow config and overridden by qualifiers in the query.
+type sendOptions struct {
+	ExpirationDays int
+	MaxAccessCount int
+	Password       string
+	HideEmail      bool
+}
+
+// parseSendQuery splits the query into the content of the Send and its options.
+// Options are leading qualifiers, e.g. "expire:3 max:5 password:secret hide-email <text>",
+// the text after them is kept as typed. "--" ends the options, e.g. for a text starting with "max:5".
+func parseSendQuery(query string) (string, sendOptions) {
+	options := sendOptions{
+		ExpirationDays: conf.SendExpirationDays,
+		MaxAccessCount: conf.SendMaxAccessCount,
+		HideEmail:      conf.SendHideEmail,
+	}
+	rest := query
+	for parsed := false; ; parsed = true {
+		trimmed := strings.TrimLeft(rest, " \t")
+		word, remaining := trimmed, ""
+		if i := strings.IndexAny(trimmed, " \t\n"); i >= 0 {
+			word, remaining = trimmed[:i], trimmed[i:]
+		}
+		if word == "--" {
+			// only the separating blank is removed
+			if remaining != "" {
+				remaining = remaining[1:]
+			}
+			return remaining, options
+		}
+		if !options.parse(word) {
+			if !parsed {
+				return query, options
+			}
+			return trimmed, options
+		}
+		rest = remaining
+	}
+}
+
+// parse sets the option of the qualifier, it returns false if the word isn't one
+func (o *sendOptions) parse(word string) bool {
+	if word == "hide-email" {
+		o.HideEmail = true
+		return true
+	}
+	key, value, found := strings.Cut(word, ":")
+	if !found {
+		return false
+	}
+	switch key {
+	case "expire":
+		if days, err := strconv.Atoi(value); err == nil {
+			o.ExpirationDays = days
+			return true
+		}
+	case "max":
+		if count, err := strconv.Atoi(value); err == nil {
+			o.MaxAccessCount = count
+			return true
+		}
+	case "password":
+		if value != "" {
+			o.Password = value
+			return true
+		}
+	}
+	return false
+}
+
+func (o sendOptions) String() string {
+	var parts []string
+	if o.ExpirationDays > 0 {
+		parts = append(parts, fmt.Sprintf("expires in %d days", o.ExpirationDays))
+	}
+	if o.MaxAccessCount > 0 {
+		parts = append(parts, fmt.Sprintf("max %d accesses", o.MaxAccessCount))
+	}
+	if o.Password != "" {
+		parts = append(parts, "password protected")
+	}
+	if o.HideEmail {
+		parts = append(parts, "email hidden")
+	}
+	if len(parts) == 0 {
+		return "no limits"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// isSendUrl checks if the string is a link to a Send, either on send.bitwarden.com
+// or on a self-hosted web vault (https://vault.example.com/#/send/<id>/<key>).
+func isSendUrl(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil || !strings.HasPrefix(u.Scheme, "http") {
+		return false
+	}
+	return strings.HasPrefix(u.Host, "send.") || strings.HasPrefix(u.Fragment, "/send/")
+}
+
+func sendTypeName(typeInt int) string {
+	switch typeInt {
+	case 0:
+		return "Text"
+	case 1:
+		return "File"
+	}
+	return "Type Name Not Found"
+}
+
+func sendSubtitle(send Send) string {
+	access := fmt.Sprintf("accessed %d times", send.AccessCount)
+	if send.MaxAccessCount != nil {
+		access = fmt.Sprintf("accessed %d/%d", send.AccessCount, *send.MaxAccessCount)
+	}
+	expiry := fmt.Sprintf("deleted %s", send.DeletionDate.Local().Format("2006-01-02 15:04"))
+	if send.ExpirationDate != nil {
+		expiry = fmt.Sprintf("expires %s", send.ExpirationDate.Local().Format("2006-01-02 15:04"))
+		if send.ExpirationDate.Before(time.Now()) {
+			expiry = "expired"
+		}
+	}
+	subtitle := fmt.Sprintf("↩ or ⇥ copy link, ⌘ delete. %s, %s, %s", sendTypeName(send.Type), access, expiry)
+	if send.PasswordSet {
+		subtitle = fmt.Sprintf("%s, password protected", subtitle)
+	}
+	if send.Disabled {
+		subtitle = fmt.Sprintf("%s, disabled", subtitle)
+	}
+	return subtitle
+}
+
+// runGetSends uses the Bitwarden CLI to get all Sends and returns them to the calling function
+func runGetSends(token string) ([]Send, error) {
+	message := "Failed to get Bitwarden Sends."
+	args := fmt.Sprintf("%s send list --session %s", conf.BwExec, token)
+	log.Println("Read latest sends...")
+
+	result, err := runCmd(args, message)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) < 1 {
+		log.Println("No sends found.")
+		return nil, nil
+	}
+	var sends []Send
+	err = json.Unmarshal([]byte(strings.Join(result, " ")), &sends)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshall sends, %s", err)
+	}
+	debugLog(fmt.Sprintf("Found %d sends.", len(sends)))
+	return sends, nil
+}
+
+// populateCacheSends caches the Sends without their content, link and password
+func populateCacheSends(sends []Send) {
+	var cacheSends []Send
+	for _, send := range sends {
+		tempSend := send
+		tempSend.AccessUrl = ""
+		tempSend.Password = ""
+		if send.Text != nil {
+			tempSend.Text = &SendText{Hidden: send.Text.Hidden}
+		}
+		cacheSends = append(cacheSends, tempSend)
+	}
+
+	if err := storeSendCache(cacheSends); err != nil {
+		log.Println(err)
+	}
+}
+
+// storeSendCache seals the Sends like the items cache, their names and access counts aren't public
+func storeSendCache(sends []Send) error {
+	data, err := json.Marshal(sends)
+	if err != nil {
+		return err
+	}
+	sealed, err := encryptMetadata(sendsKeyName, data)
+	if err != nil {
+		return err
+	}
+	return wf.Cache.Store(SEND_CACHE_NAME, sealed)
+}
+
+func loadSendCache() ([]Send, error) {
+	var sends []Send
+	sealed, err := wf.Cache.Load(SEND_CACHE_NAME)
+	if err != nil {
+		return sends, err
+	}
+	data, err := decryptMetadata(sendsKeyName, sealed)
+	if err != nil {
+		return sends, err
+	}
+	err = json.Unmarshal(data, &sends)
+	return sends, err
+}
+
+func refreshSendCache(token string) {
+	sends, err := runGetSends(token)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	populateCacheSends(sends)
+}
+
+// Filter Bitwarden Sends in Alfred
+func runSend() {
+	wf.Configure(aw.SuppressUIDs(true))
+
+	query := queryArgs()
+	content, options := parseSendQuery(query)
+
+	if isSendUrl(strings.TrimSpace(content)) {
+		wf.NewItem("Receive Send").
+			Subtitle(fmt.Sprintf("↩ or ⇥ copy the text or save the file to %s", conf.OutputFolder)).
+			Valid(true).
+			Icon(iconLink).
+			Var("action", "-sendreceive").
+			Var("notification", "Received Send").
+			Arg(query)
+	} else if content != "" {
+		if info, err := os.Stat(tilde.Abs(strings.TrimSpace(content))); err == nil && !info.IsDir() {
+			wf.NewItem(fmt.Sprintf("Create file Send: %s", filepath.Base(strings.TrimSpace(content)))).
+				Subtitle(fmt.Sprintf("↩ or ⇥ create and copy link, %s", options)).
+				Valid(true).
+				Match(query).
+				Icon(iconPaperClip).
+				Var("action", "-sendcreate").
+				Var("action2", "-file").
+				Var("notification", "Created file Send, link copied").
+				Arg(query)
+		}
+		wf.NewItem(fmt.Sprintf("Create text Send: %s", content)).
+			Subtitle(fmt.Sprintf("↩ or ⇥ create and copy link, %s", options)).
+			Valid(true).
+			Match(query).
+			Icon(iconNote).
+			Var("action", "-sendcreate").
+			Var("notification", "Created text Send, link copied").
+			Arg(query)
+	}
+
+	wf.NewItem("Create text Send from clipboard").
+		Subtitle(fmt.Sprintf("↩ or ⇥ create and copy link, %s", options)).
+		Valid(true).
+		Match(query).
+		Icon(iconNote).
+		Var("action", "-sendcreate").
+		Var("action2", "-clipboard").
+		Var("notification", "Created text Send from clipboard, link copied").
+		Arg(query)
+
+	if wf.Cache.Exists(SEND_CACHE_NAME) {
+		// e.g. a cache of an older version or sealed with the key of the other CACHE_KEY_FROM_SESSION mode
+		if _, err := loadSendCache(); err != nil {
+			log.Printf("Couldn't load the sends cache, error: %s", err)
+			if err := wf.Cache.Store(SEND_CACHE_NAME, nil); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+	if !wf.Cache.Exists(SEND_CACHE_NAME) {
+		token, err := alfred.GetToken(wf)
+		if err != nil {
+			wf.NewWarningItem("Bitwarden is locked.", "Need to unlock first to list Sends.")
+			addUnlockItem(conf.Email)
+			wf.SendFeedback()
+			return
+		}
+		refreshSendCache(token)
+	}
+
+	sends, err := loadSendCache()
+	if err != nil {
+		log.Printf("Couldn't load the sends cache, error: %s", err)
+	}
+	log.Printf("Number of sends %d", len(sends))
+	for _, send := range sends {
+		icon := iconNote
+		if send.Type == 1 {
+			icon = iconPaperClip
+		}
+		it := wf.NewItem(send.Name).
+			Subtitle(sendSubtitle(send)).
+			UID(send.Id).
+			Valid(true).
+			Icon(icon).
+			Var("action", "-sendlink").
+			Var("action2", fmt.Sprintf("-id %s", send.Id)).
+			Var("notification", fmt.Sprintf("Copied link of Send:\n%s", send.Name))
+		it.NewModifier("cmd").
+			Subtitle(fmt.Sprintf("Delete Send %q", send.Name)).
+			Icon(aw.IconTrash).
+			Var("action", "-senddelete").
+			Var("action2", fmt.Sprintf("-id %s", send.Id)).
+			Var("notification", fmt.Sprintf("Deleted Send:\n%s", send.Name))
+	}
+
+	wf.WarnEmpty("No Sends Found", "Type a text or file path to create a new Send.")
+	wf.SendFeedback()
+}
+
+func readClipboard() (string, error) {
+	out, err := exec.Command("/usr/bin/pbpaste").Output()
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// runSendCreate creates a text or file Send and prints the link to it
+func runSendCreate() {
+	wf.Configure(aw.TextErrors(true))
+	token, err := alfred.GetToken(wf)
+	if err != nil {
+		wf.Fatal("Get Token error")
+		return
+	}
+
+	content, options := parseSendQuery(queryArgs())
+	now := time.Now()
+	send := Send{
+		Name:         fmt.Sprintf("Alfred Send %s", now.Format("2006-01-02 15:04")),
+		DeletionDate: now.AddDate(0, 0, defaultSendDeletionDays),
+		Password:     options.Password,
+		HideEmail:    options.HideEmail,
+	}
+	if options.ExpirationDays > 0 {
+		expirationDate := now.AddDate(0, 0, options.ExpirationDays)
+		send.ExpirationDate = &expirationDate
+		send.DeletionDate = expirationDate
+	}
+	if options.MaxAccessCount > 0 {
+		send.MaxAccessCount = &options.MaxAccessCount
+	}
+
+	if opts.File {
+		path := tilde.Abs(strings.TrimSpace(content))
+		if _, err := os.Stat(path); err != nil {
+			wf.FatalError(err)
+			return
+		}
+		send.Type = 1
+		send.Name = filepath.Base(path)
+		// the Bitwarden CLI reads the file from the path set as the fileName
+		send.File = &SendFile{FileName: path}
+	} else {
+		if opts.Clipboard {
+			content, err = readClipboard()
+			if err != nil {
+				wf.FatalError(err)
+				return
+			}
+		}
+		if strings.TrimSpace(content) == "" {
+			wf.Fatal("No text for the Send.")
+			return
+		}
+		send.Type = 0
+		send.Text = &SendText{Text: content}
+	}
+
+	data, err := json.Marshal(send)
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+	message := "Failed to create Bitwarden Send."
+	args := fmt.Sprintf("%s send create %s --session %s", conf.BwExec, base64.StdEncoding.EncodeToString(data), token)
+	result, err := runCmd(args, message)
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+
+	var created Send
+	err = json.Unmarshal([]byte(strings.Join(result, " ")), &created)
+	if err != nil {
+		log.Printf("Failed to unmarshall created send. Err: %s", err)
+		fmt.Print(strings.Join(result, ""))
+		return
+	}
+	refreshSendCache(token)
+	fmt.Print(created.AccessUrl)
+}
+
+// runSendLink prints the link of a Send, it's not cached because it contains the key
+func runSendLink() {
+	wf.Configure(aw.TextErrors(true))
+	if opts.Id == "" {
+		wf.Fatal("No id sent.")
+		return
+	}
+	token, err := alfred.GetToken(wf)
+	if err != nil {
+		wf.Fatal("Get Token error")
+		return
+	}
+
+	message := "Failed to get Bitwarden Send."
+	args := fmt.Sprintf("%s send get %s --session %s", conf.BwExec, opts.Id, token)
+	result, err := runCmd(args, message)
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+	var send Send
+	err = json.Unmarshal([]byte(strings.Join(result, " ")), &send)
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+	fmt.Print(send.AccessUrl)
+}
+
+// runSendDelete deletes a Send and refreshes the sends cache
+func runSendDelete() {
+	wf.Configure(aw.TextErrors(true))
+	if opts.Id == "" {
+		wf.Fatal("No id sent.")
+		return
+	}
+	token, err := alfred.GetToken(wf)
+	if err != nil {
+		wf.Fatal("Get Token error")
+		return
+	}
+
+	message := "Failed to delete Bitwarden Send."
+	args := fmt.Sprintf("%s send delete %s --session %s", conf.BwExec, opts.Id, token)
+	_, err = runCmd(args, message)
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+	refreshSendCache(token)
+	fmt.Println("Deleted Send")
+}
+
+// runSendReceive prints the text of a received Send or saves its file to the output folder
+func runSendReceive() {
+	wf.Configure(aw.TextErrors(true))
+
+	link, options := parseSendQuery(queryArgs())
+	link = strings.TrimSpace(link)
+	if !isSendUrl(link) {
+		wf.Fatal("No Send link given.")
+		return
+	}
+	passwordArg := ""
+	if options.Password != "" {
+		os.Setenv("PASS", options.Password)
+		defer os.Unsetenv("PASS")
+		passwordArg = " --passwordenv PASS"
+	}
+
+	message := "Failed to receive Bitwarden Send."
+	args := fmt.Sprintf("%s receive %s --obj%s", conf.BwExec, link, passwordArg)
+	result, err := runCmd(args, message)
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+	var send Send
+	err = json.Unmarshal([]byte(strings.Join(result, " ")), &send)
+	if err != nil {
+		wf.FatalError(err)
+		return
+	}
+
+	if send.Type == 1 {
+		args = fmt.Sprintf("%s receive %s --output %s%s", conf.BwExec, link, conf.OutputFolder, passwordArg)
+		_, err = runCmd(args, message)
+		if err != nil {
+			wf.FatalError(err)
+			return
+		}
+		fileName := ""
+		if send.File != nil {
+			fileName = send.File.FileName
+		}
+		fmt.Printf("Saved Send %s to %s", fileName, conf.OutputFolder)
+		return
+	}
+	if send.Text != nil {
+		fmt.Print(send.Text.Text)
+	}
+}
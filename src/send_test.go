@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_parseSendQuery(t *testing.T) {
+	conf.SendExpirationDays = 0
+	conf.SendMaxAccessCount = 0
+	conf.SendHideEmail = false
+	tests := []struct {
+		name    string
+		query   string
+		content string
+		want    sendOptions
+	}{
+		{name: "no options", query: "hello  world\nsecond line", content: "hello  world\nsecond line"},
+		{name: "leading options", query: "expire:3 max:5 password:secret hide-email my  secret\ntext", content: "my  secret\ntext",
+			want: sendOptions{ExpirationDays: 3, MaxAccessCount: 5, Password: "secret", HideEmail: true}},
+		{name: "options in the text are kept", query: "max:2 the code is max:5", content: "the code is max:5", want: sendOptions{MaxAccessCount: 2}},
+		{name: "invalid option is text", query: "expire:soon now", content: "expire:soon now"},
+		{name: "separator", query: "expire:1 -- max:5  hide-email", content: "max:5  hide-email", want: sendOptions{ExpirationDays: 1}},
+		{name: "only options", query: "hide-email", content: "", want: sendOptions{HideEmail: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, options := parseSendQuery(tt.query)
+			if content != tt.content {
+				t.Errorf("parseSendQuery() content = %q, want %q", content, tt.content)
+			}
+			if options != tt.want {
+				t.Errorf("parseSendQuery() options = %+v, want %+v", options, tt.want)
+			}
+		})
+	}
+}
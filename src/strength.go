@@ -0,0 +1,528 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// The strength of a password is estimated like zxcvbn does it: the password is split into the
+// patterns an attacker would try first, e.g. dictionary words, keyboard walks or dates, and the
+// guesses needed for the patterns and the remaining characters are multiplied.
+
+//go:embed strength_words.txt
+var strengthWordList string
+
+var strengthWords = loadStrengthWords(strengthWordList)
+
+// Scores are reached with at least 10^3, 10^6, 10^8 and 10^10 guesses, like zxcvbn
+var strengthScoreLog10Guesses = []float64{3, 6, 8, 10}
+
+const maxStrengthScore = 4
+
+// patterns are only searched in the first characters, the repeats get slow for long passwords
+const maxStrengthPatternLength = 128
+
+// passwords shorter than this are reported as too short
+const minStrongPasswordLength = 12
+
+var leetSubstitutions = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i', '!': 'i',
+	'|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+var keyboardRows = []struct {
+	keys   string
+	offset float64
+}{
+	{"1234567890-=", 0},
+	{"qwertyuiop[]", 0.5},
+	{"asdfghjkl;'", 0.75},
+	{"zxcvbnm,./", 1.25},
+}
+
+// passwordStrength is the estimated strength from 0 (guessed immediately) to 4 (very hard to guess)
+type passwordStrength struct {
+	Score        int
+	Log10Guesses float64
+	// Reasons are human-readable explanations what makes the password weak
+	Reasons []string
+}
+
+// strengthMatch is a part of the password matching a pattern
+type strengthMatch struct {
+	start, end   int
+	log10Guesses float64
+	reason       string
+}
+
+func loadStrengthWords(list string) map[string]int {
+	words := map[string]int{}
+	rank := 0
+	for _, line := range strings.Split(list, "\n") {
+		word := strings.TrimSpace(line)
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		rank++
+		if _, ok := words[word]; !ok {
+			words[word] = rank
+		}
+	}
+	return words
+}
+
+// estimatePasswordStrength estimates how many guesses are needed to find the password,
+// the name and username of the item count as words an attacker knows
+func estimatePasswordStrength(password string, name string, username string) passwordStrength {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return passwordStrength{Reasons: []string{"empty"}}
+	}
+	// lowered per rune, so the positions match the password
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	// only the start of very long passwords is searched for patterns, the rest counts as bruteforce
+	scored := len(runes)
+	if scored > maxStrengthPatternLength {
+		scored = maxStrengthPatternLength
+	}
+	var matches []strengthMatch
+	matches = append(matches, dictionaryMatches(runes[:scored], lower[:scored], userInputWords(name, username))...)
+	matches = append(matches, keyboardWalkMatches(lower[:scored])...)
+	matches = append(matches, repeatMatches(runes[:scored], lower[:scored])...)
+	matches = append(matches, sequenceMatches(runes[:scored])...)
+	matches = append(matches, dateMatches(runes[:scored])...)
+
+	log10Guesses, used := coverMatches(runes, matches)
+	strength := passwordStrength{Log10Guesses: log10Guesses}
+	for _, threshold := range strengthScoreLog10Guesses {
+		if log10Guesses >= threshold {
+			strength.Score++
+		}
+	}
+	for _, m := range used {
+		strength.Reasons = appendUnique(strength.Reasons, m.reason)
+	}
+	if len(runes) < minStrongPasswordLength {
+		strength.Reasons = append(strength.Reasons, fmt.Sprintf("only %d chars", len(runes)))
+	}
+	if len(strength.Reasons) == 0 && strength.Score < maxStrengthScore {
+		strength.Reasons = append(strength.Reasons, "too few different characters")
+	}
+	return strength
+}
+
+// coverMatches covers the password with the longest matches first, a match is only used if it's
+// cheaper than bruteforce. It returns the guesses of the used matches and the uncovered characters.
+func coverMatches(runes []rune, matches []strengthMatch) (float64, []strengthMatch) {
+	cardinality := bruteforceCardinality(runes)
+	bruteforce := func(n int) float64 {
+		return float64(n) * math.Log10(cardinality)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		li, lj := matches[i].end-matches[i].start, matches[j].end-matches[j].start
+		if li != lj {
+			return li > lj
+		}
+		return matches[i].log10Guesses < matches[j].log10Guesses
+	})
+	covered := make([]bool, len(runes))
+	var used []strengthMatch
+	for _, m := range matches {
+		if m.log10Guesses >= bruteforce(m.end-m.start) {
+			continue
+		}
+		free := true
+		for i := m.start; i < m.end; i++ {
+			free = free && !covered[i]
+		}
+		if !free {
+			continue
+		}
+		for i := m.start; i < m.end; i++ {
+			covered[i] = true
+		}
+		used = append(used, m)
+	}
+	sort.Slice(used, func(i, j int) bool { return used[i].start < used[j].start })
+
+	log10Guesses := 0.0
+	for _, m := range used {
+		log10Guesses += m.log10Guesses
+	}
+	uncovered := 0
+	for _, c := range covered {
+		if !c {
+			uncovered++
+		}
+	}
+	return log10Guesses + bruteforce(uncovered), used
+}
+
+func appendUnique(list []string, value string) []string {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
+
+// bruteforceCardinality is the number of characters an attacker has to try for each character
+func bruteforceCardinality(runes []rune) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	cardinality := 0.0
+	for _, class := range []struct {
+		present bool
+		size    float64
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.present {
+			cardinality += class.size
+		}
+	}
+	return cardinality
+}
+
+// userInputWords are the words of the name and username with their reason, e.g. "john" of "john.doe@example.com"
+func userInputWords(name string, username string) map[string]string {
+	words := map[string]string{}
+	add := func(value string, reason string) {
+		value = strings.ToLower(value)
+		if len([]rune(value)) >= 3 {
+			words[value] = fmt.Sprintf(reason, value)
+		}
+		for _, part := range strings.FieldsFunc(value, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if len([]rune(part)) >= 3 {
+				if _, ok := words[part]; !ok {
+					words[part] = fmt.Sprintf(reason, part)
+				}
+			}
+		}
+	}
+	add(username, "contains the username '%s'")
+	add(name, "contains its name '%s'")
+	return words
+}
+
+// dictionaryMatches finds common passwords and words as well as words of the item, also with l33t substitutions
+func dictionaryMatches(runes []rune, lower []rune, userWords map[string]string) []strengthMatch {
+	unleeted := make([]rune, len(lower))
+	for i, r := range lower {
+		if sub, ok := leetSubstitutions[r]; ok {
+			unleeted[i] = sub
+		} else {
+			unleeted[i] = r
+		}
+	}
+
+	var matches []strengthMatch
+	for i := 0; i < len(lower); i++ {
+		for j := i + 3; j <= len(lower); j++ {
+			for _, candidate := range []struct {
+				word string
+				leet bool
+			}{{string(lower[i:j]), false}, {string(unleeted[i:j]), true}} {
+				if candidate.leet && candidate.word == string(lower[i:j]) {
+					continue
+				}
+				guesses := 0.0
+				reason := ""
+				if userReason, ok := userWords[candidate.word]; ok {
+					guesses, reason = 1, userReason
+				} else if rank, ok := strengthWords[candidate.word]; ok {
+					guesses, reason = float64(rank), fmt.Sprintf("contains '%s'", candidate.word)
+				} else {
+					continue
+				}
+				// capitalized or l33t variations double the guesses
+				if string(runes[i:j]) != string(lower[i:j]) {
+					guesses *= 2
+				}
+				if candidate.leet {
+					guesses *= 2
+				}
+				matches = append(matches, strengthMatch{start: i, end: j, log10Guesses: math.Log10(guesses), reason: reason})
+			}
+		}
+	}
+	return matches
+}
+
+type keyPosition struct {
+	row int
+	x   float64
+}
+
+var keyPositions = func() map[rune]keyPosition {
+	positions := map[rune]keyPosition{}
+	for row, r := range keyboardRows {
+		for col, key := range r.keys {
+			positions[key] = keyPosition{row: row, x: float64(col) + r.offset}
+		}
+	}
+	return positions
+}()
+
+func keysAdjacent(a rune, b rune) bool {
+	pa, okA := keyPositions[a]
+	pb, okB := keyPositions[b]
+	if !okA || !okB || a == b {
+		return false
+	}
+	dr := pa.row - pb.row
+	dx := math.Abs(pa.x - pb.x)
+	if dr == 0 {
+		return dx == 1
+	}
+	return (dr == 1 || dr == -1) && dx <= 0.75
+}
+
+// keyboardWalkMatches finds runs of at least 4 neighbouring keys like "qwerty" or "1qaz",
+// walks which change their direction need more guesses
+func keyboardWalkMatches(lower []rune) []strengthMatch {
+	var matches []strengthMatch
+	start := 0
+	for i := 1; i <= len(lower); i++ {
+		if i < len(lower) && keysAdjacent(lower[i-1], lower[i]) {
+			continue
+		}
+		if i-start >= 4 {
+			turns := 0
+			for k := start + 2; k < i; k++ {
+				if keyDirection(lower[k-2], lower[k-1]) != keyDirection(lower[k-1], lower[k]) {
+					turns++
+				}
+			}
+			guesses := float64(len(keyPositions)) * float64(i-start) * math.Pow(4, float64(turns))
+			matches = append(matches, strengthMatch{
+				start: start, end: i, log10Guesses: math.Log10(guesses),
+				reason: fmt.Sprintf("keyboard pattern '%s'", string(lower[start:i])),
+			})
+		}
+		start = i
+	}
+	return matches
+}
+
+// keyDirection is the direction of the step from a to b, the rows are staggered so only the signs count
+func keyDirection(a rune, b rune) [2]int {
+	pa, pb := keyPositions[a], keyPositions[b]
+	sign := func(f float64) int {
+		switch {
+		case f > 0:
+			return 1
+		case f < 0:
+			return -1
+		}
+		return 0
+	}
+	return [2]int{sign(float64(pb.row - pa.row)), sign(pb.x - pa.x)}
+}
+
+// repeatMatches finds repeated characters or parts like "aaa" or "abcabc", only by their shortest
+// base, so "abab" repeats "ab" and not "abab" as well
+func repeatMatches(runes []rune, lower []rune) []strengthMatch {
+	var matches []strengthMatch
+	baseGuesses := map[string]float64{}
+	for i := 0; i < len(lower); i++ {
+		for size := 1; i+2*size <= len(lower); size++ {
+			base := string(lower[i : i+size])
+			end := i + size
+			for end+size <= len(lower) && string(lower[end:end+size]) == base {
+				end += size
+			}
+			count := (end - i) / size
+			if count < 2 || end-i < 3 || !isPrimitiveRepeatBase(lower[i:i+size]) {
+				continue
+			}
+			guesses, ok := baseGuesses[base]
+			if !ok {
+				guesses = repeatBaseGuesses(runes[i:i+size], lower[i:i+size])
+				baseGuesses[base] = guesses
+			}
+			matches = append(matches, strengthMatch{
+				start: i, end: end, log10Guesses: guesses + math.Log10(float64(count)),
+				reason: fmt.Sprintf("repeats '%s'", base),
+			})
+		}
+	}
+	return matches
+}
+
+// isPrimitiveRepeatBase checks that the base isn't a repeat of a shorter part itself
+func isPrimitiveRepeatBase(base []rune) bool {
+	for period := 1; period < len(base); period++ {
+		if len(base)%period != 0 {
+			continue
+		}
+		repeated := true
+		for k := period; k < len(base) && repeated; k++ {
+			repeated = base[k] == base[k-period]
+		}
+		if repeated {
+			return false
+		}
+	}
+	return true
+}
+
+// repeatBaseGuesses are the guesses of the base of a repeat, it can be a pattern itself like the
+// sequence of "abcabc". Repeats aren't searched in it, the base is the shortest already.
+func repeatBaseGuesses(runes []rune, lower []rune) float64 {
+	var matches []strengthMatch
+	matches = append(matches, dictionaryMatches(runes, lower, nil)...)
+	matches = append(matches, keyboardWalkMatches(lower)...)
+	matches = append(matches, sequenceMatches(runes)...)
+	matches = append(matches, dateMatches(runes)...)
+	log10Guesses, _ := coverMatches(runes, matches)
+	return log10Guesses
+}
+
+// sequenceMatches finds runs of at least 3 letters or digits in order like "abcd" or "9876"
+func sequenceMatches(runes []rune) []strengthMatch {
+	var matches []strengthMatch
+	start := 0
+	for i := 1; i <= len(runes); i++ {
+		if i < len(runes) && sameSequenceClass(runes[i-1], runes[i]) {
+			delta := runes[i] - runes[i-1]
+			if (delta == 1 || delta == -1) && (i-start < 2 || runes[i-1]-runes[i-2] == delta) {
+				continue
+			}
+		}
+		if i-start >= 3 {
+			first := runes[start]
+			guesses := 26.0
+			if unicode.IsDigit(first) {
+				guesses = 10
+			}
+			if strings.ContainsRune("aAzZ019", first) {
+				guesses = 4
+			}
+			if runes[start+1] < first {
+				guesses *= 2
+			}
+			matches = append(matches, strengthMatch{
+				start: start, end: i, log10Guesses: math.Log10(guesses * float64(i-start)),
+				reason: fmt.Sprintf("sequence '%s'", string(runes[start:i])),
+			})
+		}
+		// the last character can start the next sequence
+		start = i
+		if i < len(runes) && i > 0 && sameSequenceClass(runes[i-1], runes[i]) {
+			if delta := runes[i] - runes[i-1]; delta == 1 || delta == -1 {
+				start = i - 1
+			}
+		}
+	}
+	return matches
+}
+
+func sameSequenceClass(a rune, b rune) bool {
+	classes := []func(rune) bool{
+		func(r rune) bool { return r >= 'a' && r <= 'z' },
+		func(r rune) bool { return r >= 'A' && r <= 'Z' },
+		func(r rune) bool { return r >= '0' && r <= '9' },
+	}
+	for _, class := range classes {
+		if class(a) && class(b) {
+			return true
+		}
+	}
+	return false
+}
+
+// dateMatches finds years like "1987" and dates of digits like "01021987", "870201" or "19870201"
+func dateMatches(runes []rune) []strengthMatch {
+	var matches []strengthMatch
+	for i := 0; i < len(runes); i++ {
+		j := i
+		for j < len(runes) && unicode.IsDigit(runes[j]) {
+			j++
+		}
+		if j == i {
+			continue
+		}
+		digits := string(runes[i:j])
+		for start := 0; start < len(digits); start++ {
+			for _, size := range []int{4, 6, 8} {
+				if start+size > len(digits) {
+					continue
+				}
+				candidate := digits[start : start+size]
+				guesses := 0.0
+				switch size {
+				case 4:
+					if isYear(candidate) {
+						guesses = 120
+					}
+				default:
+					if isDate(candidate) {
+						guesses = 365 * 100
+					}
+				}
+				if guesses == 0 {
+					continue
+				}
+				reason := fmt.Sprintf("contains a date '%s'", candidate)
+				if size == 4 {
+					reason = fmt.Sprintf("contains the year '%s'", candidate)
+				}
+				matches = append(matches, strengthMatch{
+					start: i + start, end: i + start + size, log10Guesses: math.Log10(guesses), reason: reason,
+				})
+			}
+		}
+		i = j
+	}
+	return matches
+}
+
+func isYear(digits string) bool {
+	return (strings.HasPrefix(digits, "19") || strings.HasPrefix(digits, "20")) && digits <= "2039"
+}
+
+// isDate checks the digits for a valid day and month in the common orders
+func isDate(digits string) bool {
+	validDayMonth := func(day string, month string) bool {
+		return day >= "01" && day <= "31" && month >= "01" && month <= "12"
+	}
+	switch len(digits) {
+	case 6:
+		// ddmmyy, mmddyy, yymmdd
+		return validDayMonth(digits[0:2], digits[2:4]) ||
+			validDayMonth(digits[2:4], digits[0:2]) ||
+			validDayMonth(digits[4:6], digits[2:4])
+	case 8:
+		// ddmmyyyy, mmddyyyy, yyyymmdd
+		return (isYear(digits[4:8]) && (validDayMonth(digits[0:2], digits[2:4]) || validDayMonth(digits[2:4], digits[0:2]))) ||
+			(isYear(digits[0:4]) && validDayMonth(digits[6:8], digits[4:6]))
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_estimatePasswordStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		maxScore int
+		minScore int
+		reason   string
+	}{
+		{password: "password", maxScore: 0, reason: "contains 'password'"},
+		{password: "P@ssw0rd", maxScore: 0, reason: "contains 'password'"},
+		{password: "qwerty", maxScore: 0, reason: "contains 'qwerty'"},
+		{password: "zxcvbnm,./", maxScore: 1, reason: "keyboard pattern 'zxcvbnm,./'"},
+		{password: "aaaaaaaa", maxScore: 0, reason: "repeats 'a'"},
+		{password: "abcabcabc", maxScore: 0, reason: "repeats 'abc'"},
+		{password: "98765432", maxScore: 0, reason: "sequence '98765432'"},
+		{password: "x1987", maxScore: 1, reason: "contains the year '1987'"},
+		{password: "07031987", maxScore: 1, reason: "contains a date '07031987'"},
+		{password: "GitHub!", maxScore: 0, reason: "contains its name 'github'"},
+		{password: "jdoe2000", maxScore: 1, reason: "contains the username 'jdoe'"},
+		{password: "Summer21", maxScore: 2, reason: "only 8 chars"},
+		{password: "kQ9#vLm2$xPz7!Rw", minScore: 4, maxScore: 4},
+		{password: "correct horse battery staple", minScore: 4, maxScore: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			got := estimatePasswordStrength(tt.password, "GitHub", "jdoe@example.com")
+			if got.Score < tt.minScore || got.Score > tt.maxScore {
+				t.Errorf("Score = %d, want %d to %d (%v)", got.Score, tt.minScore, tt.maxScore, got.Reasons)
+			}
+			if tt.reason != "" && !strings.Contains(strings.Join(got.Reasons, ", "), tt.reason) {
+				t.Errorf("Reasons = %v, want %q", got.Reasons, tt.reason)
+			}
+		})
+	}
+}
+
+func Test_estimatePasswordStrength_longRepeats(t *testing.T) {
+	for _, password := range []string{
+		strings.Repeat("a", 128),
+		strings.Repeat("ab", 64),
+		strings.Repeat("abcabd", 40),
+		strings.Repeat("x", 1000),
+	} {
+		start := time.Now()
+		got := estimatePasswordStrength(password, "", "")
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("estimatePasswordStrength() of %d chars took %s", len(password), elapsed)
+		}
+		if got.Score > 1 && len(password) <= maxStrengthPatternLength {
+			t.Errorf("Score of %q = %d, want a weak score (%v)", password, got.Score, got.Reasons)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/jychri/tilde"
+)
+
+// A small part of the 2factorauth directory (https://2fa.directory) with sites supporting TOTP is bundled,
+// the whole directory is downloaded with TWOFA_DIRECTORY_REFRESH or read from TWOFA_DIRECTORY_FILE.
+//
+//go:embed twofactor_directory.json
+var bundledTwoFactorDirectory []byte
+
+const twoFactorDirectoryDocs = "https://2fa.directory/"
+
+// twoFactorSite is an entry of the directory in the format of its v3 API
+type twoFactorSite struct {
+	Name              string   `json:"-"`
+	Domain            string   `json:"domain"`
+	AdditionalDomains []string `json:"additional-domains"`
+	Tfa               []string `json:"tfa"`
+	Documentation     string   `json:"documentation"`
+}
+
+func (s twoFactorSite) supportsTotp() bool {
+	for _, method := range s.Tfa {
+		if method == "totp" {
+			return true
+		}
+	}
+	return false
+}
+
+// twoFactorDirectory maps the domains to the sites supporting TOTP
+type twoFactorDirectory map[string]twoFactorSite
+
+// parseTwoFactorDirectory reads the v3 format, a list of [name, site] pairs
+func parseTwoFactorDirectory(data []byte) (twoFactorDirectory, error) {
+	var entries [][2]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid 2FA directory: %w", err)
+	}
+	directory := twoFactorDirectory{}
+	for _, entry := range entries {
+		var site twoFactorSite
+		if err := json.Unmarshal(entry[0], &site.Name); err != nil {
+			return nil, fmt.Errorf("invalid 2FA directory entry: %w", err)
+		}
+		if err := json.Unmarshal(entry[1], &site); err != nil {
+			return nil, fmt.Errorf("invalid 2FA directory entry %q: %w", site.Name, err)
+		}
+		if !site.supportsTotp() {
+			continue
+		}
+		for _, domain := range append([]string{site.Domain}, site.AdditionalDomains...) {
+			if domain != "" {
+				directory[strings.ToLower(domain)] = site
+			}
+		}
+	}
+	return directory, nil
+}
+
+// lookup returns the site of the first URL of the item found in the directory, by host or registrable domain
+func (d twoFactorDirectory) lookup(item Item) (twoFactorSite, bool) {
+	for _, uri := range item.Login.Uris {
+		for _, domain := range []string{strings.ToLower(uriHost(uri.Uri)), registrableDomain(uri.Uri)} {
+			if site, ok := d[domain]; ok && domain != "" {
+				return site, true
+			}
+		}
+	}
+	return twoFactorSite{}, false
+}
+
+// loadTwoFactorDirectory reads the directory from TWOFA_DIRECTORY_FILE, the downloaded copy or the bundled one.
+// An outdated copy is still used while the 2fa-directory job downloads the new one.
+func loadTwoFactorDirectory() (twoFactorDirectory, error) {
+	if conf.TwofaDirectoryFile != "" {
+		data, err := os.ReadFile(tilde.Abs(conf.TwofaDirectoryFile))
+		if err != nil {
+			return nil, err
+		}
+		return parseTwoFactorDirectory(data)
+	}
+
+	maxAge := time.Duration(conf.TwofaDirectoryRefresh) * day
+	if conf.TwofaDirectoryRefresh > 0 && (!wf.Data.Exists(TWOFA_DIRECTORY_NAME) || wf.Data.Expired(TWOFA_DIRECTORY_NAME, maxAge)) {
+		startTwoFactorDirectoryRefresh()
+	}
+	if conf.TwofaDirectoryRefresh > 0 && wf.Data.Exists(TWOFA_DIRECTORY_NAME) {
+		data, err := wf.Data.Load(TWOFA_DIRECTORY_NAME)
+		if err == nil {
+			return parseTwoFactorDirectory(data)
+		}
+		log.Printf("Couldn't load the 2FA directory, using the bundled one, error: %s", err)
+	}
+	return parseTwoFactorDirectory(bundledTwoFactorDirectory)
+}
+
+// startTwoFactorDirectoryRefresh downloads the directory in the background, unless the download is
+// running already or failed recently
+func startTwoFactorDirectoryRefresh() {
+	if wf.IsRunning("2fa-directory") {
+		log.Printf("2FA directory job already running.")
+		return
+	}
+	if backoff := loadTwoFactorDirectoryBackoff(); !backoff.allows(time.Now()) {
+		log.Printf("Downloading the 2FA directory failed %d times, next attempt at %s", backoff.Failures, backoff.Next.Format(time.RFC3339))
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-twofadirectory")
+	if err := wf.RunInBackground("2fa-directory", cmd); err != nil {
+		log.Printf("Couldn't start the 2FA directory download, error: %s", err)
+	}
+}
+
+// runRefreshTwoFactorDirectory is the 2fa-directory job, after a failure the next attempt is delayed like the automatic sync
+func runRefreshTwoFactorDirectory() {
+	if err := refreshTwoFactorDirectory(); err != nil {
+		backoff := loadTwoFactorDirectoryBackoff().failed(time.Now())
+		log.Printf("Couldn't refresh the 2FA directory, next attempt at %s, error: %s", backoff.Next.Format(time.RFC3339), err)
+		if err := wf.Cache.StoreJSON(TWOFA_BACKOFF_NAME, backoff); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+	if err := wf.Cache.StoreJSON(TWOFA_BACKOFF_NAME, nil); err != nil {
+		log.Println(err)
+	}
+}
+
+func loadTwoFactorDirectoryBackoff() syncBackoff {
+	var backoff syncBackoff
+	if wf.Cache.Exists(TWOFA_BACKOFF_NAME) {
+		if err := wf.Cache.LoadJSON(TWOFA_BACKOFF_NAME, &backoff); err != nil {
+			log.Printf("Couldn't load the 2FA directory backoff, error: %s", err)
+		}
+	}
+	return backoff
+}
+
+// refreshTwoFactorDirectory downloads the directory from TWOFA_DIRECTORY_URL, it's only stored if it can be parsed
+func refreshTwoFactorDirectory() error {
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Get(conf.TwofaDirectoryUrl)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", conf.TwofaDirectoryUrl, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if _, err := parseTwoFactorDirectory(data); err != nil {
+		return err
+	}
+	return wf.Data.Store(TWOFA_DIRECTORY_NAME, data)
+}
@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func Test_twoFactorDirectory(t *testing.T) {
+	data := []byte(`[
+		["Example", {"domain": "example.com", "additional-domains": ["example.org"], "tfa": ["sms", "totp"], "documentation": "https://example.com/2fa"}],
+		["SMS Only", {"domain": "sms.example", "tfa": ["sms"]}]
+	]`)
+	directory, err := parseTwoFactorDirectory(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		uris []string
+		want string
+	}{
+		{"domain", []string{"https://example.com/login"}, "Example"},
+		{"subdomain", []string{"https://login.example.com"}, "Example"},
+		{"additional domain", []string{"example.org"}, "Example"},
+		{"second url", []string{"androidapp://com.example", "https://www.example.org"}, "Example"},
+		{"no totp", []string{"https://sms.example"}, ""},
+		{"unknown", []string{"https://other.com"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var item Item
+			for _, uri := range tt.uris {
+				item.Login.Uris = append(item.Login.Uris, Uri{Uri: uri})
+			}
+			site, _ := directory.lookup(item)
+			if site.Name != tt.want {
+				t.Errorf("lookup() = %q, want %q", site.Name, tt.want)
+			}
+		})
+	}
+
+	t.Run("bundled directory", func(t *testing.T) {
+		bundled, err := parseTwoFactorDirectory(bundledTwoFactorDirectory)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if site, ok := bundled["github.com"]; !ok || site.Documentation == "" {
+			t.Errorf("github.com = %+v, want an entry with documentation", site)
+		}
+	})
+}
@@ -13,6 +13,23 @@ type Folder struct {
 	Name   string `json:"name"`
 }
 
+type Collection struct {
+	Object         string `json:"object"`
+	Id             string `json:"id"`
+	OrganizationId string `json:"organizationId"`
+	Name           string `json:"name"`
+	ExternalId     string `json:"externalId"`
+}
+
+type Organization struct {
+	Object  string `json:"object"`
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	Status  int    `json:"status"`
+	Type    int    `json:"type"`
+	Enabled bool   `json:"enabled"`
+}
+
 type Field struct {
 	Name  string `json:"name"`
 	Value string `json:"value"`
@@ -95,5 +112,42 @@ type Item struct {
 	SecureNote     SecureNoteType `json:"secureNote,omitempty"`
 	CollectionIds  []string       `json:"collectionIds"`
 	RevisionDate   time.Time      `json:"revisionDate"`
+	CreationDate   time.Time      `json:"creationDate"`
 	Attachments    []Attachments  `json:"attachments,omitempty"`
 }
+
+type SendText struct {
+	Text   string `json:"text"`
+	Hidden bool   `json:"hidden"`
+}
+
+type SendFile struct {
+	Id       string `json:"id,omitempty"`
+	FileName string `json:"fileName"`
+	Size     string `json:"size,omitempty"`
+	SizeName string `json:"sizeName,omitempty"`
+}
+
+// https://github.com/bitwarden/jslib/blob/master/common/src/enums/sendType.ts
+// 0: Text
+// 1: File
+type Send struct {
+	Object         string     `json:"object,omitempty"`
+	Id             string     `json:"id,omitempty"`
+	AccessId       string     `json:"accessId,omitempty"`
+	AccessUrl      string     `json:"accessUrl,omitempty"`
+	Name           string     `json:"name"`
+	Notes          string     `json:"notes,omitempty"`
+	Type           int        `json:"type"`
+	Text           *SendText  `json:"text,omitempty"`
+	File           *SendFile  `json:"file,omitempty"`
+	MaxAccessCount *int       `json:"maxAccessCount"`
+	AccessCount    int        `json:"accessCount"`
+	RevisionDate   time.Time  `json:"revisionDate"`
+	DeletionDate   time.Time  `json:"deletionDate"`
+	ExpirationDate *time.Time `json:"expirationDate"`
+	Password       string     `json:"password,omitempty"`
+	PasswordSet    bool       `json:"passwordSet,omitempty"`
+	Disabled       bool       `json:"disabled"`
+	HideEmail      bool       `json:"hideEmail"`
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2020 Claas Lisowski <github@lisowski-development.com>
+// MIT Licence - http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	aw "github.com/deanishe/awgo"
+)
+
+const (
+	usageKeyName = "usagePassword"
+	// only the latest uses of an item count for the ranking
+	maxUsagesPerItem = 20
+)
+
+// usageHistory maps the item id to the times it was used, oldest first
+type usageHistory map[string][]time.Time
+
+// Buckets of the frecency score, recent uses count more than old ones
+var usageBuckets = []struct {
+	maxAge time.Duration
+	weight float64
+}{
+	{4 * 24 * time.Hour, 100},
+	{14 * 24 * time.Hour, 70},
+	{31 * 24 * time.Hour, 50},
+	{90 * 24 * time.Hour, 30},
+}
+
+const usageOldWeight = 10
+
+// loadUsageHistory reads the encrypted usage history, an empty history is returned if none exists yet
+func loadUsageHistory() (usageHistory, error) {
+	history := usageHistory{}
+	if !wf.Data.Exists(USAGE_HISTORY_NAME) {
+		return history, nil
+	}
+	data, err := wf.Data.Load(USAGE_HISTORY_NAME)
+	if err != nil {
+		return history, err
+	}
+	decrypted, err := decryptWithKey(usageKeyName, data)
+	if err != nil {
+		return history, err
+	}
+	err = json.Unmarshal(decrypted, &history)
+	return history, err
+}
+
+func (h usageHistory) save() error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	encrypted, err := encryptWithKey(usageKeyName, data)
+	if err != nil {
+		return err
+	}
+	return wf.Data.Store(USAGE_HISTORY_NAME, encrypted)
+}
+
+func (h usageHistory) record(id string, now time.Time) {
+	uses := append(h[id], now)
+	if len(uses) > maxUsagesPerItem {
+		uses = uses[len(uses)-maxUsagesPerItem:]
+	}
+	h[id] = uses
+}
+
+// score combines how often and how recently the item was used
+func (h usageHistory) score(id string, now time.Time) float64 {
+	score := 0.0
+	for _, used := range h[id] {
+		weight := float64(usageOldWeight)
+		age := now.Sub(used)
+		for _, bucket := range usageBuckets {
+			if age <= bucket.maxAge {
+				weight = bucket.weight
+				break
+			}
+		}
+		score += weight
+	}
+	return score
+}
+
+// recent returns up to n ids of the items used last, the latest first
+func (h usageHistory) recent(n int) []string {
+	ids := make([]string, 0, len(h))
+	for id, uses := range h {
+		if len(uses) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return h.lastUsed(ids[i]).After(h.lastUsed(ids[j]))
+	})
+	if len(ids) > n {
+		ids = ids[:n]
+	}
+	return ids
+}
+
+func (h usageHistory) lastUsed(id string) time.Time {
+	uses := h[id]
+	if len(uses) == 0 {
+		return time.Time{}
+	}
+	return uses[len(uses)-1]
+}
+
+// rankByUsage adds the frecency of the items to the search score, a single recent use
+// is worth a bit less than a prefix match of the name with the default weights
+func rankByUsage(results []searchResult, h usageHistory, now time.Time) {
+	for i := range results {
+		results[i].Score += h.score(results[i].Item.Id, now) / 15
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+}
+
+// sortByUsage orders the items by their frecency, unused items keep the vault order
+func sortByUsage(items []Item, h usageHistory, now time.Time) []Item {
+	sorted := make([]Item, len(items))
+	copy(sorted, items)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return h.score(sorted[i].Id, now) > h.score(sorted[j].Id, now)
+	})
+	return sorted
+}
+
+// recordUsage stores that the item was used, it's called whenever an action copies or opens something
+func recordUsage(id string) {
+	if !conf.UsageHistory || id == "" {
+		return
+	}
+	history, err := loadUsageHistory()
+	if err != nil {
+		log.Printf("Failed to load usage history, starting a new one: %s", err)
+		history = usageHistory{}
+	}
+	history.record(id, time.Now())
+	if err := history.save(); err != nil {
+		log.Printf("Failed to save usage history: %s", err)
+	}
+}
+
+// runUsage records the usage of the item, it's run by Alfred when a value is copied directly
+func runUsage() {
+	recordUsage(opts.Id)
+}
+
+// runResetUsage deletes the usage history and its key
+func runResetUsage() {
+	wf.Configure(aw.TextErrors(true))
+	if err := wf.Data.Store(USAGE_HISTORY_NAME, nil); err != nil {
+		wf.FatalError(err)
+		return
+	}
+	if err := wf.Keychain.Delete(usageKeyName); err != nil {
+		log.Println(err)
+	}
+	fmt.Println("Usage history reset")
+}
+
+// loadUsageHistoryForSearch returns nil if the history is disabled or can't be read
+func loadUsageHistoryForSearch() usageHistory {
+	if !conf.UsageHistory {
+		return nil
+	}
+	history, err := loadUsageHistory()
+	if err != nil {
+		log.Printf("Failed to load usage history: %s", err)
+		return nil
+	}
+	return history
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_usageHistory(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	history := usageHistory{}
+	// "old" was used often but long ago, "new" once yesterday
+	for i := 0; i < 3; i++ {
+		history.record("old", now.Add(-200*day))
+	}
+	history.record("new", now.Add(-day))
+	history.record("mid", now.Add(-20*day))
+	history.record("mid", now.Add(-10*day))
+
+	t.Run("score", func(t *testing.T) {
+		tests := map[string]float64{"old": 30, "new": 100, "mid": 120, "unused": 0}
+		for id, want := range tests {
+			if got := history.score(id, now); got != want {
+				t.Errorf("score(%s) = %v, want %v", id, got, want)
+			}
+		}
+	})
+
+	t.Run("recent", func(t *testing.T) {
+		want := []string{"new", "mid"}
+		if got := history.recent(2); !reflect.DeepEqual(got, want) {
+			t.Errorf("recent() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("record keeps the latest uses", func(t *testing.T) {
+		h := usageHistory{}
+		for i := 0; i < maxUsagesPerItem+5; i++ {
+			h.record("id", now.Add(time.Duration(i)*time.Minute))
+		}
+		if len(h["id"]) != maxUsagesPerItem {
+			t.Fatalf("len = %d, want %d", len(h["id"]), maxUsagesPerItem)
+		}
+		if !h.lastUsed("id").Equal(now.Add(time.Duration(maxUsagesPerItem+4) * time.Minute)) {
+			t.Errorf("lastUsed() = %v", h.lastUsed("id"))
+		}
+	})
+
+	t.Run("sortByUsage keeps vault order of unused items", func(t *testing.T) {
+		items := []Item{{Id: "a"}, {Id: "old"}, {Id: "b"}, {Id: "mid"}, {Id: "new"}}
+		var got []string
+		for _, item := range sortByUsage(items, history, now) {
+			got = append(got, item.Id)
+		}
+		want := []string{"mid", "new", "old", "a", "b"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("sortByUsage() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("rankByUsage boosts used items", func(t *testing.T) {
+		results := []searchResult{{Item: Item{Id: "a"}, Score: 8}, {Item: Item{Id: "new"}, Score: 6}}
+		rankByUsage(results, history, now)
+		if results[0].Item.Id != "new" {
+			t.Errorf("rankByUsage() first = %s, want new", results[0].Item.Id)
+		}
+	})
+}
@@ -69,8 +69,13 @@ func checkReturn(status cmd.Status, message string) ([]string, error) {
 }
 
 func runCmd(args string, message string) ([]string, error) {
+	return runCmdArgs(strings.Fields(args), message)
+}
+
+// runCmdArgs is like runCmd but takes the already split arguments,
+// e.g. when a file path can contain spaces
+func runCmdArgs(argSet []string, message string) ([]string, error) {
 	// Start a long-running process, capture stdout and stderr
-	argSet := strings.Fields(args)
 	runCmd := cmd.NewCmd(argSet[0], argSet[1:]...)
 	status := <-runCmd.Start()
 
@@ -115,6 +120,19 @@ func getItemsInFolderCount(folderId string, items []Item) int {
 	return counter
 }
 
+func getItemsInCollectionCount(collectionId string, items []Item) int {
+	counter := 0
+	for _, item := range items {
+		for _, id := range item.CollectionIds {
+			if id == collectionId {
+				counter += 1
+				break
+			}
+		}
+	}
+	return counter
+}
+
 func commandExists(cmd string) bool {
 	_, err := exec.LookPath(cmd)
 	return err == nil
@@ -156,7 +174,12 @@ func clearCache() error {
 	if err != nil {
 		return err
 	}
-	err = wf.Cache.StoreJSON(FOLDER_CACHE_NAME, nil)
+	return clearMetadataCache()
+}
+
+// clearMetadataCache clears the caches besides the items, the items cache is updated incrementally by a sync
+func clearMetadataCache() error {
+	err := wf.Cache.StoreJSON(FOLDER_CACHE_NAME, nil)
 	if err != nil {
 		return err
 	}
@@ -164,6 +187,22 @@ func clearCache() error {
 	if err != nil {
 		return err
 	}
+	err = wf.Cache.StoreJSON(SEND_CACHE_NAME, nil)
+	if err != nil {
+		return err
+	}
+	err = wf.Cache.StoreJSON(COLLECTION_CACHE_NAME, nil)
+	if err != nil {
+		return err
+	}
+	err = wf.Cache.StoreJSON(ORGANIZATION_CACHE_NAME, nil)
+	if err != nil {
+		return err
+	}
+	err = wf.Cache.StoreJSON(EXCLUDED_CACHE_NAME, nil)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 